@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// cloudPort is the secure native protocol port ClickHouse Cloud listens on.
+const cloudPort = "9440"
+
+// isCloudHost reports whether addr, as host or host:port, is a ClickHouse
+// Cloud hostname.
+func isCloudHost(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return strings.HasSuffix(host, ".clickhouse.cloud")
+}
+
+// applyCloudDefaults sets up opts for ClickHouse Cloud: TLS, the secure
+// native port when none is given, and LZ4 compression.
+func applyCloudDefaults(opts *clickhouse.Options) {
+	if opts.TLS == nil {
+		opts.TLS = &tls.Config{}
+	}
+	for i, addr := range opts.Addr {
+		_, port, err := net.SplitHostPort(addr)
+		switch {
+		case err != nil:
+			// JoinHostPort adds the brackets of an IPv6 literal itself
+			host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+			opts.Addr[i] = net.JoinHostPort(host, cloudPort)
+		case port != cloudPort:
+			log.Printf("Warning: %s is not on the ClickHouse Cloud secure native port %s", addr, cloudPort)
+		}
+	}
+	if opts.Compression == nil {
+		opts.Compression = &clickhouse.Compression{Method: clickhouse.CompressionLZ4}
+	}
+}
+
+// warnInsecureCloud warns about ClickHouse Cloud hosts used without TLS,
+// which Cloud requires.
+func warnInsecureCloud(opts *clickhouse.Options) {
+	if opts.TLS != nil {
+		return
+	}
+	for _, addr := range opts.Addr {
+		if isCloudHost(addr) {
+			log.Printf("Warning: %s is a ClickHouse Cloud host but TLS is not enabled, use -cloud or secure=true in the DSN", addr)
+		}
+	}
+}
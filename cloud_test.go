@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestClientOptionsIPv6(t *testing.T) {
+	for _, tc := range []struct {
+		dsn  string
+		addr string
+	}{
+		{"clickhouse://user:pass@[::1]:9000", "[::1]:9000"},
+		{"clickhouse://[2001:db8::1]:9440/default", "[2001:db8::1]:9440"},
+		{"clickhouse://[fe80::1%25eth0]:9000", "[fe80::1%eth0]:9000"},
+		{"clickhouse://127.0.0.1:9000", "127.0.0.1:9000"},
+	} {
+		opts, err := clientOptions(tc.dsn, false, false, nil)
+		if err != nil {
+			t.Errorf("clientOptions(%q): %v", tc.dsn, err)
+			continue
+		}
+		if len(opts.Addr) != 1 || opts.Addr[0] != tc.addr {
+			t.Errorf("clientOptions(%q).Addr = %q, want [%q]", tc.dsn, opts.Addr, tc.addr)
+		}
+	}
+}
+
+func TestApplyCloudDefaultsPort(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		want string
+	}{
+		{"abc.clickhouse.cloud", "abc.clickhouse.cloud:9440"},
+		{"abc.clickhouse.cloud:9440", "abc.clickhouse.cloud:9440"},
+		{"[::1]", "[::1]:9440"},
+		{"[::1]:9440", "[::1]:9440"},
+		{"[2001:db8::1]:9000", "[2001:db8::1]:9000"},
+	} {
+		opts := &clickhouse.Options{Addr: []string{tc.addr}}
+		applyCloudDefaults(opts)
+		if opts.Addr[0] != tc.want {
+			t.Errorf("applyCloudDefaults(%q) = %q, want %q", tc.addr, opts.Addr[0], tc.want)
+		}
+	}
+}
+
+func TestIsCloudHost(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"abc.clickhouse.cloud", true},
+		{"abc.clickhouse.cloud:9440", true},
+		{"localhost:9000", false},
+		{"[::1]:9000", false},
+		{"[::1]", false},
+	} {
+		if got := isCloudHost(tc.addr); got != tc.want {
+			t.Errorf("isCloudHost(%q) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
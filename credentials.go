@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// authErrorCodes are the codes of the exceptions the server rejects
+// credentials with: UNKNOWN_USER, WRONG_PASSWORD, REQUIRED_PASSWORD and
+// AUTHENTICATION_FAILED.
+var authErrorCodes = map[int32]bool{192: true, 193: true, 194: true, 516: true}
+
+// isAuthError returns whether err is the server rejecting the credentials.
+func isAuthError(err error) bool {
+	var e *clickhouse.Exception
+	return errors.As(err, &e) && authErrorCodes[e.Code]
+}
+
+// fetchedPasswords are the passwords -credentials-command printed, redacted
+// from the logs by redactingWriter.
+var fetchedPasswords struct {
+	sync.Mutex
+	values []string
+}
+
+// redactFetched replaces the fetched passwords in s.
+func redactFetched(s string) string {
+	fetchedPasswords.Lock()
+	defer fetchedPasswords.Unlock()
+	for _, password := range fetchedPasswords.values {
+		s = strings.ReplaceAll(s, password, redacted)
+	}
+	return s
+}
+
+// credentials are the user and password of a server, fetched again with
+// -credentials-command whenever the server rejects them, e.g. once a
+// short-lived token expires, so that long captures survive rotations.
+type credentials struct {
+	command string
+	// addr is passed to command, to tell the servers of -facet apart.
+	addr string
+
+	mu sync.Mutex
+	// fetched is whether password, and user if set, replace those of the
+	// DSN.
+	fetched        bool
+	user, password string
+	// generation counts the fetches, so that dials rejected with the same
+	// credentials fetch new ones once between them.
+	generation int
+}
+
+// dial is a clickhouse.Options.DialStrategy that dials with the current
+// credentials and, if the server rejects them, fetches new ones and dials
+// once more.
+func (c *credentials) dial(ctx context.Context, connID int, opts *clickhouse.Options, dial clickhouse.Dial) (clickhouse.DialResult, error) {
+	withCredentials, generation := c.apply(opts)
+	result, err := clickhouse.DefaultDialStrategy(ctx, connID, withCredentials, dial)
+	if err == nil || !isAuthError(err) {
+		return result, err
+	}
+	log.Printf("%s rejected the credentials, fetching new ones with -credentials-command: %v", c.addr, err)
+	if err := c.refresh(generation); err != nil {
+		return result, fmt.Errorf("error running -credentials-command: %v", err)
+	}
+	withCredentials, _ = c.apply(opts)
+	return clickhouse.DefaultDialStrategy(ctx, connID, withCredentials, dial)
+}
+
+// apply returns a copy of opts with the current credentials, and their
+// generation.
+func (c *credentials) apply(opts *clickhouse.Options) (*clickhouse.Options, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	withCredentials := *opts
+	if c.fetched {
+		withCredentials.Auth.Password = c.password
+		if c.user != "" {
+			withCredentials.Auth.Username = c.user
+		}
+	}
+	return &withCredentials, c.generation
+}
+
+// refresh runs the command unless the credentials of generation were
+// already replaced, e.g. by a concurrent dial.
+func (c *credentials) refresh(generation int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return nil
+	}
+	user, password, err := runCredentialsCommand(c.command, c.addr)
+	if err != nil {
+		return err
+	}
+	fetchedPasswords.Lock()
+	fetchedPasswords.values = append(fetchedPasswords.values, password)
+	fetchedPasswords.Unlock()
+	if user != "" {
+		c.user = user
+	}
+	c.fetched, c.password = true, password
+	c.generation++
+	log.Printf("Fetched new credentials for %s, reconnecting", c.addr)
+	return nil
+}
+
+// runCredentialsCommand runs command with sh, with addr as the last
+// argument. It prints the password, or the user and the password on two
+// lines. Its stderr is not logged, as it may echo the secret.
+func runCredentialsCommand(command, addr string) (user, password string, err error) {
+	out, err := exec.Command("sh", "-c", command+` "$@"`, "sh", addr).Output()
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	switch {
+	case len(lines) == 1 && lines[0] != "":
+		return "", lines[0], nil
+	case len(lines) == 2 && lines[0] != "" && lines[1] != "":
+		return lines[0], lines[1], nil
+	}
+	return "", "", fmt.Errorf("expected a password, or a user and a password on two lines")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix prefixes the environment variables that mirror the flags, e.g.
+// CLICKHOUSE_MONITOR_INTERVAL for -interval.
+const envPrefix = "CLICKHOUSE_MONITOR_"
+
+// envName returns the environment variable mirroring the flag name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// envOthers are the variables with envPrefix that mirror no flag: the DSN,
+// and the chart path passed to -at-exit-command.
+var envOthers = []string{"dsn", "chart"}
+
+// applyEnv sets every flag not given on the command line from its
+// environment variable, if set, so that flags take precedence. The flags it
+// sets count as given for fs.Visit, like those on the command line. A variable
+// with envPrefix that mirrors no flag is an error rather than ignored, as
+// it is most likely a typo.
+func applyEnv(fs *flag.FlagSet) error {
+	known := map[string]bool{}
+	for _, name := range envOthers {
+		known[envName(name)] = true
+	}
+	fs.VisitAll(func(f *flag.Flag) { known[envName(f.Name)] = true })
+	var unknown []string
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, envPrefix) && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("no flag matches %s, see -help", strings.Join(unknown, " or "))
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s %q: %v", envName(f.Name), value, setErr)
+		}
+	})
+	return err
+}
+
+// usage prints the flags and how they can also be set from the
+// environment.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] DSN [DSN...]\n\n", os.Args[0])
+	fmt.Fprintf(out, "Every flag can also be set from the environment, e.g. %s=1s for\n", envName("interval"))
+	fmt.Fprintf(out, "-interval, and the DSN from %s. Flags on the command line take\n", envName("dsn"))
+	fmt.Fprintf(out, "precedence over the environment, which takes precedence over the defaults.\n\n")
+	flag.PrintDefaults()
+}
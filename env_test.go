@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestApplyEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	interval := fs.Duration("interval", time.Second, "")
+	keeper := fs.Bool("keeper", false, "")
+	output := fs.String("output", "chart.png", "")
+	if err := fs.Parse([]string{"-interval", "5s"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLICKHOUSE_MONITOR_INTERVAL", "10s")
+	t.Setenv("CLICKHOUSE_MONITOR_KEEPER", "true")
+	t.Setenv("CLICKHOUSE_MONITOR_DSN", "clickhouse://localhost:9000")
+	if err := applyEnv(fs); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if *interval != 5*time.Second {
+		t.Errorf("-interval = %s, want the 5s given on the command line", *interval)
+	}
+	if !*keeper {
+		t.Errorf("-keeper = false, want true from the environment")
+	}
+	if *output != "chart.png" {
+		t.Errorf("-output = %q, want the default", *output)
+	}
+	// The flags set from the environment count as given, for applyPreset
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if !given["interval"] || !given["keeper"] || given["output"] {
+		t.Errorf("given flags = %v, want interval and keeper", given)
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	tests := []struct {
+		name, variable, value string
+	}{
+		{"invalid value", "CLICKHOUSE_MONITOR_INTERVAL", "soon"},
+		{"no such flag", "CLICKHOUSE_MONITOR_INTERVALL", "1s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Duration("interval", time.Second, "")
+			t.Setenv(tt.variable, tt.value)
+			if err := applyEnv(fs); err == nil {
+				t.Errorf("applyEnv with %s=%s = nil, want an error", tt.variable, tt.value)
+			}
+		})
+	}
+}
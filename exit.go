@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"clickhouse-monitor/monitor"
+)
+
+// Exit codes, so that scripts can tell failures apart.
+const (
+	exitOK = 0
+	// exitFailure is any other failure at runtime, e.g. writing outputs.
+	exitFailure = 1
+	// exitConfig is an invalid flag, DSN or other startup configuration.
+	exitConfig = 2
+	// exitThreshold means a configured threshold, e.g. -max-connection-rate,
+	// was breached.
+	exitThreshold = 3
+	// exitConnection means ClickHouse could not be reached.
+	exitConnection = 4
+)
+
+// errorLog logs fatal errors. It bypasses -quiet.
+var errorLog = log.New(os.Stderr, "", log.LstdFlags)
+
+// fatalf logs a fatal error and exits with code. With -validate-config,
+// configuration errors are collected instead, see configProblems.
+func fatalf(code int, format string, v ...any) {
+	if validatingConfig && code == exitConfig {
+		configProblems = append(configProblems, fmt.Sprintf(format, v...))
+		return
+	}
+	errorLog.Printf(format, v...)
+	os.Exit(code)
+}
+
+// errorsOnlyWriter forwards only error log lines, i.e. those using the
+// "Error ..." wording of this tool's error messages.
+type errorsOnlyWriter struct {
+	w io.Writer
+}
+
+func (e errorsOnlyWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("Error ")) {
+		return e.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// redactingWriter forwards log lines with the -via-remote password redacted,
+// as errors may echo the queries that carry it, and the passwords fetched
+// with -credentials-command.
+type redactingWriter struct {
+	w      io.Writer
+	remote *monitor.Remote
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactFetched(r.remote.Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"clickhouse-monitor/monitor"
+)
+
+// keyValueFlag is a repeatable flag of key=value pairs.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	f[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	return nil
+}
+
+// listFlag is a repeatable flag collecting every value given.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// seriesFlag is a repeatable flag of name=query series, in the order given.
+type seriesFlag []monitor.Series
+
+func (f *seriesFlag) String() string {
+	pairs := make([]string, len(*f))
+	for i, s := range *f {
+		pairs[i] = s.Name + "=" + s.Query
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func (f *seriesFlag) Set(s string) error {
+	name, query, ok := strings.Cut(s, "=")
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+	if !ok || name == "" || query == "" {
+		return fmt.Errorf("expected name=query, got %q", s)
+	}
+	if slices.ContainsFunc(*f, func(s monitor.Series) bool { return s.Name == name }) {
+		return fmt.Errorf("duplicate series %q", name)
+	}
+	*f = append(*f, monitor.Series{Name: name, Query: query})
+	return nil
+}
+
+// names returns the names of the series, in the order given.
+func (f seriesFlag) names() []string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// durationsFlag is a comma-separated list of ascending durations.
+type durationsFlag []time.Duration
+
+func (f *durationsFlag) String() string {
+	values := make([]string, len(*f))
+	for i, d := range *f {
+		values[i] = d.String()
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *durationsFlag) Set(s string) error {
+	var durations []time.Duration
+	for _, value := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		durations = append(durations, d)
+	}
+	if !slices.IsSorted(durations) {
+		return fmt.Errorf("expected ascending durations, got %q", s)
+	}
+	*f = durations
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// runAtExitCommand runs command with sh once the chart is written to path,
+// e.g. to upload it. The path is appended as the last argument and also set
+// as CLICKHOUSE_MONITOR_CHART. Its output is logged line by line, and a
+// non-zero exit status is returned as an error.
+func runAtExitCommand(command, path string) error {
+	cmd := exec.Command("sh", "-c", command+` "$@"`, "sh", path)
+	cmd.Env = append(os.Environ(), envName("chart")+"="+path)
+	out, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		log.Printf("-at-exit-command: %s", scanner.Text())
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("-at-exit-command succeeded")
+	return nil
+}
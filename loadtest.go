@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// loadTestBaseline is how long -load-test monitors before adding load, so
+// that the chart shows the server at rest first.
+const loadTestBaseline = 10 * time.Second
+
+// loadTestQuery is the harmless query -load-test runs, holding a connection
+// and a query slot for a second without touching any data.
+const loadTestQuery = "SELECT sleep(1)"
+
+// confirmLoadTest asks on the terminal before generating load on addr.
+func confirmLoadTest(addr string, workers int, d time.Duration) bool {
+	if !isTerminal(os.Stdin) {
+		errorLog.Printf("-load-test needs confirmation on a terminal, pass -yes to skip it")
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "-load-test will run %d concurrent %q queries against %s for %s. Type yes to proceed: ", workers, loadTestQuery, addr, d)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// runLoadTest runs workers concurrent loops of loadTestQuery on their own
+// connections for d, or until ctx is done.
+func runLoadTest(ctx context.Context, opts *clickhouse.Options, workers int, d time.Duration) {
+	loadOpts := *opts
+	loadOpts.MaxOpenConns = workers
+	loadOpts.MaxIdleConns = workers
+	conn, err := clickhouse.Open(&loadOpts)
+	if err != nil {
+		log.Printf("Error opening load test connections: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	var queries, failed atomic.Uint64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				queries.Add(1)
+				if err := conn.Exec(ctx, loadTestQuery); err != nil && ctx.Err() == nil {
+					// Back off rather than spin while the server refuses
+					failed.Add(1)
+					sleepCtx(ctx, time.Second)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	log.Printf("Load test stopped after %d queries (%d failed)", queries.Load(), failed.Load())
+}
+
+// sleepCtx sleeps for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// logFile is a -log-file that rotates itself once it reaches maxSize bytes,
+// renaming it to path.1, path.2 and so on, and can be reopened after an
+// external tool like logrotate moved it.
+type logFile struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openLogFile(path string, maxSize int64) (*logFile, error) {
+	l := &logFile{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open appends to path, so that a restarted daemon keeps the earlier logs.
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// Reopen reopens the file at path. The old file is only closed once the new
+// one is open, so that logging carries on to it if reopening fails.
+func (l *logFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.f
+	if err := l.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Write writes one log line. Lines are never split across files, as the log
+// package writes each in a single call.
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file to the first free path.N and starts a new one.
+func (l *logFile) rotate() error {
+	n := 1
+	for {
+		if _, err := os.Stat(fmt.Sprintf("%s.%d", l.path, n)); os.IsNotExist(err) {
+			break
+		}
+		n++
+	}
+	// Nowhere to report a failed rename, so keep logging to the old file
+	os.Rename(l.path, fmt.Sprintf("%s.%d", l.path, n))
+	old := l.f
+	if err := l.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPruneCharts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"clickhouse-metrics-20240101-120000.png",
+		"clickhouse-metrics-20240101-120000.thumb.png",
+		"clickhouse-metrics-20240101-130000.000.png",
+		"clickhouse-metrics-20240101-130000.500.png",
+		"clickhouse-metrics-20240101-130000.500.meta.json",
+		"clickhouse-metrics-20240101-140000.png",
+		"clickhouse-metrics-20240101-140000.partial.png",
+		"clickhouse-metrics-merged-20240101-100000.png",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pruneCharts(dir, 2); err != nil {
+		t.Fatalf("pruneCharts: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{
+		"clickhouse-metrics-20240101-130000.500.meta.json",
+		"clickhouse-metrics-20240101-130000.500.png",
+		"clickhouse-metrics-20240101-140000.partial.png",
+		"clickhouse-metrics-20240101-140000.png",
+		"clickhouse-metrics-merged-20240101-100000.png",
+		"notes.txt",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"clickhouse-monitor/monitor"
+)
+
+// redacted replaces hosts and secrets in the .meta.json sidecars.
+const redacted = "[REDACTED]"
+
+// secretFlags are the flags whose values are redacted from the sidecars, as
+// they hold a host, a password or a URL with a token in it.
+var secretFlags = map[string]bool{"via-remote": true, "via-remote-password": true, "webhook-url": true}
+
+// runMeta is the effective configuration of a run, written next to its
+// outputs as <output>.meta.json so that every capture can be reproduced.
+type runMeta struct {
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	RunID     string    `json:"run_id"`
+	Started   time.Time `json:"started"`
+	// DSNs have their host and password redacted.
+	DSNs []string `json:"dsns"`
+	// Flags holds the value of every flag, given or not, so that defaults
+	// changed between versions do not go unnoticed.
+	Flags map[string]string `json:"flags"`
+	// Metrics are the Measurement fields collected, by their JSON name.
+	Metrics       []string `json:"metrics"`
+	ProfileEvents []string `json:"profile_events,omitempty"`
+}
+
+func newRunMeta(runID string, dsns []string, opts monitor.Options) runMeta {
+	meta := runMeta{
+		Version:       version(),
+		GoVersion:     runtime.Version(),
+		RunID:         runID,
+		Started:       time.Now(),
+		Flags:         map[string]string{},
+		Metrics:       collectedMetrics(opts),
+		ProfileEvents: opts.ProfileEvents,
+	}
+	for _, dsn := range dsns {
+		meta.DSNs = append(meta.DSNs, redactDSN(dsn))
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = redacted
+		}
+		meta.Flags[f.Name] = value
+	})
+	return meta
+}
+
+// version returns the module version, or the VCS revision of a development
+// build.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	revision, ok := settings["vcs.revision"]
+	if !ok {
+		return "(devel)"
+	}
+	if settings["vcs.modified"] == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// redactDSN returns dsn without its host and password, keeping the scheme,
+// user, database and settings.
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	query := u.Query()
+	if query.Has("password") {
+		query.Set("password", redacted)
+	}
+	var b strings.Builder
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.Username() + "@")
+	}
+	b.WriteString(redacted + u.EscapedPath())
+	if len(query) > 0 {
+		b.WriteString("?" + strings.ReplaceAll(query.Encode(), url.QueryEscape(redacted), redacted))
+	}
+	return b.String()
+}
+
+// collectedMetrics returns the JSON names of the Measurement fields opts
+// collects.
+func collectedMetrics(opts monitor.Options) []string {
+	metrics := []string{"timestamp", "connections", "query_duration_ns", "round_trip_ns"}
+	if opts.ServerAggregate {
+		// Nothing else is collected from metric_log
+		return append(metrics, "connections_avg")
+	}
+	for _, optional := range []struct {
+		collected bool
+		fields    []string
+	}{
+		{opts.ConnectionSource == monitor.ConnectionsBoth, []string{"active_queries"}},
+		{opts.CountDistinctClients, []string{"distinct_clients"}},
+		{opts.QueryLogLatency, []string{"query_p50_ns", "query_p99_ns"}},
+		{opts.WatchTable != "", []string{"table_rows"}},
+		{opts.DashboardQuery != "", []string{"dashboard_value"}},
+		{len(opts.ProfileEvents) > 0, []string{"profile_events"}},
+		{len(opts.Series) > 0, []string{"metrics"}},
+		{opts.Keeper, []string{"keeper_sessions", "keeper_requests"}},
+		{opts.QueryQueue, []string{"queries_running", "queries_waiting"}},
+		{opts.Distributed, []string{"distributed_sends", "distributed_files_to_insert"}},
+		{opts.Uptime, []string{"uptime_ns"}},
+	} {
+		if optional.collected {
+			metrics = append(metrics, optional.fields...)
+		}
+	}
+	return metrics
+}
+
+// metaName returns the sidecar of output, e.g. chart.meta.json for
+// chart.png.
+func metaName(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".meta.json"
+}
+
+// writeMeta writes meta next to output.
+func writeMeta(output string, meta runMeta) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	// Keep the & of DSN settings readable
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+	return os.WriteFile(metaName(output), b.Bytes(), 0o644)
+}
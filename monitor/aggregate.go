@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// collectAggregated reads the per-second connection aggregates that
+// system.metric_log recorded since the previous call, with their times
+// shifted by Options.ClockOffset. Every measurement of a batch has the
+// duration of the query that fetched it. A failed query yields a single
+// failed measurement, like Collect.
+func (m *Monitor) collectAggregated(ctx context.Context) []Measurement {
+	start := time.Now()
+	rows, err := m.clickhouse.conn.Query(m.clickhouse.queryContext(ctx), fmt.Sprintf(`
+		SELECT
+			toStartOfSecond(event_time_microseconds) AS second,
+			max(CurrentMetric_TCPConnection + CurrentMetric_HTTPConnection),
+			avg(CurrentMetric_TCPConnection + CurrentMetric_HTTPConnection)
+		FROM %s
+		WHERE event_time_microseconds >= fromUnixTimestamp64Micro(%d)
+		GROUP BY second
+		ORDER BY second;`, m.clickhouse.table("metric_log"), m.aggregatedUntil.Add(m.opts.ClockOffset).UnixMicro()))
+	if err != nil {
+		log.Printf("Error querying metric_log aggregates: %v", err)
+		m.onError("metric_log aggregates", err)
+		return []Measurement{failedMeasurement(start)}
+	}
+	defer rows.Close()
+
+	var batch []Measurement
+	for rows.Next() {
+		var (
+			second   time.Time
+			maxConns int64
+			avgConns float64
+		)
+		if err := rows.Scan(&second, &maxConns, &avgConns); err != nil {
+			log.Printf("Error reading metric_log aggregates: %v", err)
+			m.onError("metric_log aggregates", err)
+			return []Measurement{failedMeasurement(start)}
+		}
+		batch = append(batch, Measurement{Timestamp: second.Add(-m.opts.ClockOffset), Connections: int(maxConns), ConnectionsAvg: avgConns})
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading metric_log aggregates: %v", err)
+		m.onError("metric_log aggregates", err)
+		return []Measurement{failedMeasurement(start)}
+	}
+
+	duration := time.Since(start)
+	for i := range batch {
+		batch[i].QueryDuration = duration
+		batch[i].RoundTrip = duration
+	}
+	// Resume after the last second returned, as metric_log records each
+	// second once
+	if len(batch) > 0 {
+		m.aggregatedUntil = batch[len(batch)-1].Timestamp.Add(time.Second)
+	}
+	return batch
+}
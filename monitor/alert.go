@@ -0,0 +1,60 @@
+package monitor
+
+import "time"
+
+// ConnectionRateAlert is a Sink that calls OnBreach whenever connections
+// grow faster than MaxRate per second from one sample to the next. It
+// catches connection storms before they reach an absolute limit.
+type ConnectionRateAlert struct {
+	MaxRate  float64
+	OnBreach func(rate float64, m Measurement)
+
+	prev *Measurement
+}
+
+func (a *ConnectionRateAlert) Write(m Measurement) error {
+	// Failed samples carry no connection count
+	if m.Failed {
+		return nil
+	}
+	if a.prev != nil {
+		if rate, ok := perSecond(a.prev, &m, float64(a.prev.Connections), float64(m.Connections)); ok && rate > a.MaxRate {
+			a.OnBreach(rate, m)
+		}
+	}
+	a.prev = &m
+	return nil
+}
+
+// ThresholdAlert is a Sink that calls OnBreach for every sample whose
+// connections reach MaxConnections, or whose query duration exceeds
+// SLODuration. Zero limits are not checked.
+type ThresholdAlert struct {
+	MaxConnections int
+	SLODuration    time.Duration
+	OnBreach       func(b Breach)
+}
+
+// Breach is a threshold a sample breached. Durations are in milliseconds.
+type Breach struct {
+	// Metric is what was breached, e.g. "connections" or "slo".
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (a *ThresholdAlert) Write(m Measurement) error {
+	// Failed samples carry no values
+	if m.Failed {
+		return nil
+	}
+	if a.MaxConnections > 0 && m.Connections >= a.MaxConnections {
+		a.OnBreach(Breach{Metric: "connections", Value: float64(m.Connections), Threshold: float64(a.MaxConnections), Timestamp: m.Timestamp})
+	}
+	if a.SLODuration > 0 && m.QueryDuration > a.SLODuration {
+		ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+		a.OnBreach(Breach{Metric: "slo", Value: ms(m.QueryDuration), Threshold: ms(a.SLODuration), Timestamp: m.Timestamp})
+	}
+	return nil
+}
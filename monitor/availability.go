@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"image/color"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// availabilityHeight is the height of the availability band.
+var availabilityHeight = vg.Points(5)
+
+var (
+	availableColor   = color.RGBA{G: 160, A: 255}
+	unavailableColor = color.RGBA{R: 200, A: 255}
+	pausedColor      = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+)
+
+// availabilityBand draws a thin band along the bottom of a subplot, green
+// where samples succeeded, red where they failed and grey where collection
+// was paused. Each sample covers the
+// time from halfway after the previous one to halfway before the next. It
+// has no data range, so it does not stretch the axes.
+type availabilityBand struct {
+	xs     []float64
+	failed []bool
+	paused []bool
+}
+
+func newAvailabilityBand(measurements []Measurement) availabilityBand {
+	b := availabilityBand{xs: make([]float64, len(measurements)), failed: make([]bool, len(measurements)), paused: make([]bool, len(measurements))}
+	for i := range measurements {
+		b.xs[i] = offset(&measurements[0], &measurements[i]).Seconds()
+		b.failed[i] = measurements[i].Failed
+		b.paused[i] = measurements[i].Paused
+	}
+	return b
+}
+
+func (b availabilityBand) Plot(c draw.Canvas, p *plot.Plot) {
+	trX, _ := p.Transforms(&c)
+	for i, x := range b.xs {
+		from, to := x, x
+		if i > 0 {
+			from = (b.xs[i-1] + x) / 2
+		}
+		if i < len(b.xs)-1 {
+			to = (x + b.xs[i+1]) / 2
+		}
+		minX, maxX := max(trX(from), c.Min.X), min(trX(to), c.Max.X)
+		if maxX <= minX {
+			continue
+		}
+		fill := availableColor
+		if b.paused[i] {
+			fill = pausedColor
+		} else if b.failed[i] {
+			fill = unavailableColor
+		}
+		c.FillPolygon(fill, []vg.Point{
+			{X: minX, Y: c.Min.Y}, {X: maxX, Y: c.Min.Y},
+			{X: maxX, Y: c.Min.Y + availabilityHeight}, {X: minX, Y: c.Min.Y + availabilityHeight},
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"image/color"
+	"math"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// addBaseline draws the mean of pts over the first window of the run as a
+// reference line, and overlays every later point colored by how far it
+// deviates from it: green at or below the baseline, shading to red at twice
+// the baseline and above. Gaps in pts, see finiteRuns, are skipped.
+func addBaseline(p *plot.Plot, pts plotter.XYs, window time.Duration, opts ChartOptions) error {
+	runs, _ := finiteRuns(opts.Normalize.apply(pts))
+	pts = nil
+	for _, run := range runs {
+		pts = append(pts, run...)
+	}
+
+	var sum float64
+	var n int
+	for _, pt := range pts {
+		if pt.X > window.Seconds() {
+			break
+		}
+		sum += pt.Y
+		n++
+	}
+	if n == 0 || n == len(pts) {
+		return nil
+	}
+	mean := sum / float64(n)
+
+	line, err := plotter.NewLine(plotter.XYs{{X: pts[0].X, Y: mean}, {X: pts[len(pts)-1].X, Y: mean}})
+	if err != nil {
+		return err
+	}
+	line.Color = color.RGBA{G: 140, A: 255}
+	line.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+	p.Add(line)
+	p.Legend.Add("baseline", line)
+
+	after := pts[n:]
+	overlay, err := plotter.NewScatter(after)
+	if err != nil {
+		return err
+	}
+	radius := opts.GlyphRadius
+	if radius == 0 {
+		radius = DefaultGlyphRadius
+	}
+	overlay.GlyphStyleFunc = func(i int) draw.GlyphStyle {
+		return draw.GlyphStyle{
+			Color:  deviationColor(after[i].Y, mean),
+			Radius: radius,
+			Shape:  draw.CircleGlyph{},
+		}
+	}
+	p.Add(overlay)
+	return nil
+}
+
+// deviationColor shades from green for values at or below mean to red for
+// values twice as far from zero as mean or more.
+func deviationColor(v, mean float64) color.Color {
+	d := 0.0
+	if mean != 0 {
+		d = (v - mean) / math.Abs(mean)
+	} else if v > 0 {
+		d = 1
+	}
+	d = math.Max(0, math.Min(1, d))
+	return color.RGBA{R: uint8(200 * d), G: uint8(160 * (1 - d)), A: 255}
+}
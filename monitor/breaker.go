@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultBreakerSamples is the number of consecutive slow collections that
+// open the circuit breaker when Options.BreakerSamples is zero.
+const DefaultBreakerSamples = 3
+
+// DefaultBreakerCooldown is how long the open circuit breaker pauses
+// collection when Options.BreakerCooldown is zero.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// breaker pauses collection while the server is in distress, see
+// Options.BreakerLatency.
+type breaker struct {
+	// slow counts the consecutive collections slower than BreakerLatency.
+	slow int
+	// halfOpen is whether collection resumed after a pause and has not
+	// been fast since, so that a single slow collection pauses it again.
+	halfOpen bool
+}
+
+// pausedMeasurement marks the start or the end of a pause of collection at
+// t, see Measurement.Paused.
+func pausedMeasurement(t, created time.Time) Measurement {
+	return Measurement{Timestamp: t, Elapsed: t.Sub(created), Failed: true, Paused: true}
+}
+
+// checkBreaker opens the circuit breaker once Options.BreakerSamples
+// consecutive collections took longer than Options.BreakerLatency, pausing
+// collection for Options.BreakerCooldown. The pause is published as a
+// pair of paused measurements, so that charts leave a gap. It returns false
+// if ctx is done first.
+func (m *Monitor) checkBreaker(ctx context.Context, elapsed time.Duration) bool {
+	if m.opts.BreakerLatency <= 0 {
+		return true
+	}
+	b := &m.breaker
+	if elapsed <= m.opts.BreakerLatency {
+		if b.halfOpen {
+			b.halfOpen = false
+			log.Printf("Circuit breaker closed: collecting took %s, under %s", elapsed.Round(time.Millisecond), m.opts.BreakerLatency)
+		}
+		b.slow = 0
+		return true
+	}
+	b.slow++
+	if b.slow < m.opts.BreakerSamples && !b.halfOpen {
+		return true
+	}
+
+	if b.halfOpen {
+		log.Printf("Circuit breaker open again: collecting still took %s, pausing collection for %s", elapsed.Round(time.Millisecond), m.opts.BreakerCooldown)
+	} else {
+		log.Printf("Circuit breaker open: collecting took over %s for %d consecutive samples, the last %s, pausing collection for %s", m.opts.BreakerLatency, b.slow, elapsed.Round(time.Millisecond), m.opts.BreakerCooldown)
+	}
+	m.health.recordPause()
+	if !m.publish(ctx, pausedMeasurement(time.Now(), m.created)) {
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(m.opts.BreakerCooldown):
+	}
+	m.health.recordPause()
+	if !m.publish(ctx, pausedMeasurement(time.Now(), m.created)) {
+		return false
+	}
+	b.slow = 0
+	b.halfOpen = true
+	log.Printf("Circuit breaker half-open: resuming collection, a single slow sample pauses it again")
+	return true
+}
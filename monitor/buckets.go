@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// PercentileBucket holds percentiles of the durations of the user queries
+// that finished in the bucket starting at Start.
+type PercentileBucket struct {
+	Start         time.Time
+	P50, P90, P99 time.Duration
+	Queries       uint64
+}
+
+// QueryLogPercentiles returns p50, p90 and p99 of the durations of the
+// queries that finished between from and to, per bucket of the given width,
+// from system.query_log. The queries exclude matches are left out, as are
+// those whose query_id starts with runID-, i.e. the monitor's own, if it is
+// set. Buckets without queries are omitted.
+func QueryLogPercentiles(ctx context.Context, conn driver.Conn, systemDB string, from, to time.Time, bucket time.Duration, runID string, exclude QueryLogExclusion) ([]PercentileBucket, error) {
+	conditions, args := exclude.withRunID(runID).where()
+	query := fmt.Sprintf(`
+		SELECT
+			toStartOfInterval(event_time, toIntervalSecond(%d)) AS bucket,
+			quantiles(0.5, 0.9, 0.99)(query_duration_ms),
+			count()
+		FROM %s
+		WHERE type = 'QueryFinish'
+			AND event_time >= toDateTime(?) AND event_time <= toDateTime(?)
+			%s
+		GROUP BY bucket
+		ORDER BY bucket;`, int64(bucket.Seconds()), systemTable(systemDB, "query_log"), conditions)
+	rows, err := conn.Query(ctx, query, append([]any{from.Unix(), to.Unix()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []PercentileBucket
+	for rows.Next() {
+		var (
+			start     time.Time
+			quantiles []float64
+			count     uint64
+		)
+		if err := rows.Scan(&start, &quantiles, &count); err != nil {
+			return nil, err
+		}
+		ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+		buckets = append(buckets, PercentileBucket{Start: start, P50: ms(quantiles[0]), P90: ms(quantiles[1]), P99: ms(quantiles[2]), Queries: count})
+	}
+	return buckets, rows.Err()
+}
+
+// addPercentileBuckets plots the p50, p90 and p99 of the buckets of width
+// overlapping start to end together on p, with each bucket placed at its
+// start, in seconds since start. The first bucket usually begins before the
+// run, so it is placed at start instead.
+func addPercentileBuckets(p *plot.Plot, buckets []PercentileBucket, width time.Duration, start, end time.Time, unit DurationUnit, opts ChartOptions) error {
+	var shown []PercentileBucket
+	for _, b := range buckets {
+		if b.Start.Add(width).After(start) && !b.Start.After(end) {
+			shown = append(shown, b)
+		}
+	}
+	for i, q := range []struct {
+		name  string
+		value func(PercentileBucket) time.Duration
+	}{
+		{"p50", func(b PercentileBucket) time.Duration { return b.P50 }},
+		{"p90", func(b PercentileBucket) time.Duration { return b.P90 }},
+		{"p99", func(b PercentileBucket) time.Duration { return b.P99 }},
+	} {
+		pts := make(plotter.XYs, len(shown))
+		for j, b := range shown {
+			pts[j].X = max(b.Start.Sub(start).Seconds(), 0)
+			pts[j].Y = unit.of(q.value(b))
+		}
+		if err := addNamedSeries(p, pts, i, q.name, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
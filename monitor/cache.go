@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"math"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+// CacheEvents are the system.events counters that ChartOptions.CacheHitRates
+// plots, to be collected with Options.ProfileEvents.
+var CacheEvents = []string{"MarkCacheHits", "MarkCacheMisses", "UncompressedCacheHits", "UncompressedCacheMisses"}
+
+// hitRateSeries returns the percentage of cache lookups that hit between
+// consecutive successful samples, from the hits and misses counters.
+// Intervals without lookups have no point rather than a made-up ratio, and
+// failed samples, which carry no counters, are skipped over. A pause leaves
+// a gap, like in rateSeries.
+func hitRateSeries(measurements []Measurement, hits, misses string) plotter.XYs {
+	var pts plotter.XYs
+	var prev *Measurement
+	for i := range measurements {
+		cur := &measurements[i]
+		if cur.Paused {
+			pts = append(pts, plotter.XY{X: offset(&measurements[0], cur).Seconds(), Y: math.NaN()})
+			prev = nil
+			continue
+		}
+		if cur.ProfileEvents == nil {
+			continue
+		}
+		if prev != nil && cur.ProfileEvents[hits] >= prev.ProfileEvents[hits] && cur.ProfileEvents[misses] >= prev.ProfileEvents[misses] {
+			h := float64(cur.ProfileEvents[hits] - prev.ProfileEvents[hits])
+			m := float64(cur.ProfileEvents[misses] - prev.ProfileEvents[misses])
+			if h+m > 0 {
+				pts = append(pts, plotter.XY{X: offset(&measurements[0], cur).Seconds(), Y: 100 * h / (h + m)})
+			}
+		}
+		prev = cur
+	}
+	return pts
+}
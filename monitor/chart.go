@@ -0,0 +1,1010 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// DefaultGlyphRadius is the point glyph radius when ChartOptions.GlyphRadius
+// is zero.
+const DefaultGlyphRadius = vg.Length(2.5)
+
+// DefaultDPI is the output resolution when ChartOptions.DPI is zero.
+const DefaultDPI = vgimg.DefaultDPI
+
+// DensePoints is the number of samples above which PointsAuto drops point
+// glyphs, as they merge into a blob of markers.
+const DensePoints = 500
+
+// PointsMode controls whether series are drawn with point glyphs.
+type PointsMode string
+
+const (
+	// PointsAuto draws glyphs unless a series has more than DensePoints
+	// samples.
+	PointsAuto   PointsMode = "auto"
+	PointsAlways PointsMode = "always"
+	PointsNever  PointsMode = "never"
+)
+
+// DurationUnit is the unit query durations are plotted in.
+type DurationUnit string
+
+const (
+	Nanoseconds  DurationUnit = "ns"
+	Microseconds DurationUnit = "us"
+	Milliseconds DurationUnit = "ms"
+	Seconds      DurationUnit = "s"
+)
+
+// DefaultDurationUnit keeps the resolution of sub-millisecond metric queries
+// on fast local servers.
+const DefaultDurationUnit = Microseconds
+
+// of returns d expressed in the unit.
+func (u DurationUnit) of(d time.Duration) float64 {
+	switch u {
+	case Nanoseconds:
+		return float64(d)
+	case Milliseconds:
+		return float64(d) / float64(time.Millisecond)
+	case Seconds:
+		return d.Seconds()
+	}
+	return float64(d) / float64(time.Microsecond)
+}
+
+func (u DurationUnit) String() string {
+	if u == Microseconds || u == "" {
+		return "µs"
+	}
+	return string(u)
+}
+
+type ChartOptions struct {
+	// GlyphRadius is the radius of the point glyphs. Defaults to
+	// DefaultGlyphRadius.
+	GlyphRadius vg.Length
+	// DurationUnit is the unit of the query duration axis. Defaults to
+	// DefaultDurationUnit.
+	DurationUnit DurationUnit
+	// Points controls whether point glyphs are drawn. Defaults to PointsAuto.
+	Points PointsMode
+	// DPI is the resolution of the PNG. The chart keeps its size in points,
+	// so a higher DPI yields more pixels. Defaults to DefaultDPI.
+	DPI int
+	// Width, if positive, is the width of the PNG in pixels, with the height
+	// scaled to keep the aspect ratio. The chart is laid out at that size
+	// rather than downscaled, so its text stays legible.
+	Width int
+	// DistinctClients adds a subplot for Measurement.DistinctClients.
+	DistinctClients bool
+	// QueryLogLatency plots Measurement.QueryP50 and QueryP99 as the query
+	// duration instead of the monitor's own query duration.
+	QueryLogLatency bool
+	// WatchTable, if set, adds a subplot for Measurement.TableRows titled
+	// with the table name.
+	WatchTable string
+	// WatchTableRate also plots the per-second insert rate into WatchTable.
+	WatchTableRate bool
+	// WatchExpr, if set, is what Measurement.TableRows holds instead of the
+	// row count, see Options.WatchExpr, for the subplot titles.
+	WatchExpr string
+	// Dashboard, if set, adds a subplot for Measurement.DashboardValue
+	// titled with the system.dashboards panel title.
+	Dashboard string
+	// ProfileEvents adds a subplot with the per-second rate of each of these
+	// Measurement.ProfileEvents.
+	ProfileEvents []string
+	// Normalize rescales every series on its own. Thresholds are not drawn
+	// on normalized charts.
+	Normalize Normalization
+	// MaxXTicks, if positive, limits the number of labelled ticks on the
+	// time axis so that labels stay readable on long runs.
+	MaxXTicks int
+	// DedupeStale draws the system.query_log percentiles, which only
+	// refresh when the server flushes the log, from one update to the next
+	// instead of as stairsteps of repeated values.
+	DedupeStale bool
+	// BaselineWindow, if positive, uses the mean connections and query
+	// duration over this first part of the run as a baseline, and colors
+	// later samples by how much worse they are than it.
+	BaselineWindow time.Duration
+	// LabelPeaks marks the highest connection count and query duration with
+	// their value and time.
+	LabelPeaks bool
+	// MaxConnections, if positive, is drawn as a threshold line on the
+	// connections subplot.
+	MaxConnections int
+	// ConnectionChurn adds a subplot with the change in connections from
+	// one sample to the next.
+	ConnectionChurn bool
+	// LatencyHistogram adds a bar chart of how many samples' query
+	// durations fall in each of the LatencyBuckets.
+	LatencyHistogram bool
+	// LatencyBuckets are the ascending bucket edges of the latency
+	// histogram. Defaults to DefaultLatencyBuckets.
+	LatencyBuckets []time.Duration
+	// SLODuration, if positive, is drawn as a threshold line on the query
+	// duration subplot, with the area above it shaded.
+	SLODuration time.Duration
+	// CompareMetric adds a scatter plot of query duration against
+	// connections, with a regression line and the correlation coefficient.
+	CompareMetric bool
+	// ConnectionSource is what Measurement.Connections counts, see
+	// Options.ConnectionSource. With ConnectionsProcesses the subplot is
+	// titled for queries, and with ConnectionsBoth
+	// Measurement.ActiveQueries is plotted next to the sockets.
+	ConnectionSource ConnectionSource
+	// ServerAggregate plots Measurement.ConnectionsAvg next to the
+	// connections, which then hold the per-second maximum.
+	ServerAggregate bool
+	// Keeper adds a subplot for Measurement.KeeperSessions and
+	// KeeperRequests.
+	Keeper bool
+	// QueryQueue adds a subplot for Measurement.QueriesRunning and
+	// QueriesWaiting.
+	QueryQueue bool
+	// Distributed adds a subplot for Measurement.DistributedSends and
+	// DistributedFilesToInsert.
+	Distributed bool
+	// QueryLogBuckets, see QueryLogPercentiles, adds a subplot of the
+	// query_log percentiles per bucket of width QueryLogBucket.
+	QueryLogBuckets []PercentileBucket
+	QueryLogBucket  time.Duration
+	// Availability draws a band along the bottom of the connections
+	// subplot, green where samples succeeded and red where they failed,
+	// see Measurement.Failed.
+	Availability bool
+	// AnnotateRestarts marks every server restart, i.e. every decrease of
+	// Measurement.Uptime, with a vertical line on every time subplot.
+	AnnotateRestarts bool
+	// Events are marked with a labelled vertical line on every time
+	// subplot, see QueryEvents.
+	Events []Event
+	// AxisUnits selects the Y axis labels of the subplots titled by its
+	// keys, e.g. AxisBytes for a byte counter. Other subplots use AxisSI,
+	// except for durations, which are plain.
+	AxisUnits map[string]AxisUnit
+	// CacheHitRates adds a subplot of the mark and uncompressed cache hit
+	// rates, from the CacheEvents in Measurement.ProfileEvents.
+	CacheHitRates bool
+	// IOThroughput adds a subplot of the bytes read and written per second,
+	// from the IOEvents in Measurement.ProfileEvents, to tell whether
+	// slowness is I/O-bound.
+	IOThroughput bool
+	// Metrics adds a subplot of these Measurement.Metrics of a MetricSource,
+	// see NewWithSource.
+	Metrics []string
+	// Palette, if set, recolors the chart, see LoadPalette.
+	Palette *Palette
+	// Transparent leaves the background of the chart and its subplots
+	// fully transparent, whatever the Palette, for compositing onto
+	// slides or colored dashboards.
+	Transparent bool
+	// Zoom restricts the chart to a window of the run. Other outputs still
+	// get every sample.
+	Zoom Zoom
+	// Tail, if positive, restricts the chart to this much before the last
+	// sample, e.g. for live charts of what is happening now. It applies
+	// after Zoom.
+	Tail time.Duration
+	// MaxSamples, if positive, downsamples the chart to at most this many
+	// samples, keeping peaks and failures, after Zoom and Tail. Other
+	// outputs still get every sample.
+	MaxSamples int
+	// Overview adds a subplot above the others of the key series, each as
+	// a percentage of its own maximum, as an at-a-glance summary.
+	Overview bool
+}
+
+// glyphShapes is cycled through per series so that series sharing a subplot
+// stay distinguishable without relying on color, e.g. in grayscale prints.
+var glyphShapes = []draw.GlyphDrawer{
+	draw.CircleGlyph{},
+	draw.SquareGlyph{},
+	draw.TriangleGlyph{},
+	draw.CrossGlyph{},
+}
+
+// RenderChartImage renders the measurements as a chart image, for
+// applications embedding the package to composite, serve or process without
+// encoding it first.
+func RenderChartImage(measurements []Measurement, opts ChartOptions) (image.Image, error) {
+	img, err := generateChart(measurements, opts)
+	if err != nil {
+		return nil, err
+	}
+	return img.Image(), nil
+}
+
+// RenderChart renders the measurements as a PNG chart into w.
+func RenderChart(w io.Writer, measurements []Measurement, opts ChartOptions) error {
+	img, err := RenderChartImage(measurements, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("error writing PNG: %v", err)
+	}
+	return nil
+}
+
+// RenderChartContext is like RenderChart, but returns the error of ctx if it
+// is done before the chart is rendered, e.g. on a timeout for a very large
+// chart. Nothing is written to w then.
+func RenderChartContext(ctx context.Context, w io.Writer, measurements []Measurement, opts ChartOptions) error {
+	return renderContext(ctx, w, func(w io.Writer) error {
+		return RenderChart(w, measurements, opts)
+	})
+}
+
+// renderContext runs render into a buffer in a goroutine, copying the result
+// to w unless ctx is done first. gonum cannot be interrupted, so an
+// abandoned render runs on in the background until it finishes.
+func renderContext(ctx context.Context, w io.Writer, render func(io.Writer) error) error {
+	if ctx.Done() == nil {
+		return render(w)
+	}
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- render(&buf) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return fmt.Errorf("error writing PNG: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error rendering chart: %w", ctx.Err())
+	}
+}
+
+// WriteChart renders the measurements and atomically replaces filename with
+// the result, so viewers never read a half-written image.
+func WriteChart(filename string, measurements []Measurement, opts ChartOptions) error {
+	return WriteChartContext(context.Background(), filename, measurements, opts)
+}
+
+// WriteChartContext is like WriteChart, leaving filename alone if ctx is
+// done before the chart is rendered, see RenderChartContext.
+func WriteChartContext(ctx context.Context, filename string, measurements []Measurement, opts ChartOptions) error {
+	return writeAtomically(filename, func(w io.Writer) error {
+		return RenderChartContext(ctx, w, measurements, opts)
+	})
+}
+
+// writeAtomically writes the output of render to a temporary file next to
+// filename and renames it over filename.
+func writeAtomically(filename string, render func(io.Writer) error) error {
+	w, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer os.Remove(w.Name())
+
+	if err := render(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing PNG: %v", err)
+	}
+	if err := os.Rename(w.Name(), filename); err != nil {
+		return fmt.Errorf("error renaming chart: %v", err)
+	}
+	return nil
+}
+
+// loggedGaps holds the series that addNamedSeries has logged gaps in, as
+// it only logs them the first time.
+var loggedGaps sync.Map
+
+// addSeries adds pts to p as a line with point glyphs, giving the series the
+// i-th shape of the glyph palette.
+func addSeries(p *plot.Plot, pts plotter.XYs, i int, opts ChartOptions) error {
+	return addNamedSeries(p, pts, i, "", opts)
+}
+
+// addNamedSeries is like addSeries but also adds the series to the legend
+// under name, unless name is empty. Named series share a subplot, so they
+// are also told apart by the i-th color of the palette.
+func addNamedSeries(p *plot.Plot, pts plotter.XYs, i int, name string, opts ChartOptions) error {
+	if len(pts) == 0 {
+		// Left to the "no data" placeholder if the whole subplot is empty
+		if name != "" {
+			p.Legend.Add(name + " (no data)")
+		}
+		return nil
+	}
+	pts = opts.Normalize.apply(pts)
+	runs, dropped := finiteRuns(pts)
+	if dropped > 0 {
+		where := p.Title.Text
+		if name != "" {
+			where += " (" + name + ")"
+		}
+		// Live charts and snapshots render the same series over and over
+		if _, logged := loggedGaps.LoadOrStore(where, true); !logged {
+			log.Printf("Leaving gaps for %d NaN, infinite, failed or paused points in %s", dropped, where)
+		}
+	}
+	if len(runs) == 0 {
+		if name != "" {
+			p.Legend.Add(name + " (no data)")
+		}
+		return nil
+	}
+	glyphs := opts.Points == PointsAlways || (opts.Points != PointsNever && len(pts) <= DensePoints)
+	for j, run := range runs {
+		line, points, err := plotter.NewLinePoints(run)
+		if err != nil {
+			return err
+		}
+		if opts.Palette != nil {
+			line.Color = opts.Palette.series(i)
+			points.Color = opts.Palette.series(i)
+		} else if name != "" {
+			line.Color = plotutil.Color(i)
+			points.Color = plotutil.Color(i)
+		}
+		if !glyphs {
+			p.Add(line)
+			if name != "" && j == 0 {
+				p.Legend.Add(name, line)
+			}
+			continue
+		}
+		points.GlyphStyle.Shape = glyphShapes[i%len(glyphShapes)]
+		points.GlyphStyle.Radius = opts.GlyphRadius
+		if points.GlyphStyle.Radius == 0 {
+			points.GlyphStyle.Radius = DefaultGlyphRadius
+		}
+		p.Add(line, points)
+		if name != "" && j == 0 {
+			p.Legend.Add(name, line, points)
+		}
+	}
+	return nil
+}
+
+// addNoData marks a subplot none of whose series has any points, e.g. a rate
+// over a single sample, so that the rest of the chart still renders.
+func addNoData(p *plot.Plot, opts ChartOptions) error {
+	labels, err := plotter.NewLabels(plotter.XYLabels{
+		XYs:    plotter.XYs{{X: 0.5, Y: 0.5}},
+		Labels: []string{"no data"},
+	})
+	if err != nil {
+		return err
+	}
+	labels.TextStyle[0].XAlign = draw.XCenter
+	labels.TextStyle[0].Font.Size = vg.Points(20)
+	if opts.Palette != nil {
+		labels.TextStyle[0].Color = opts.Palette.Text
+	}
+	p.Add(labels)
+	p.X.Min, p.X.Max, p.Y.Min, p.Y.Max = 0, 1, 0, 1
+	return nil
+}
+
+// addThreshold draws a dashed horizontal line at y across the time range of
+// pts, extending the Y axis to include it.
+func addThreshold(p *plot.Plot, pts plotter.XYs, y float64, label string) error {
+	line, err := plotter.NewLine(plotter.XYs{{X: pts[0].X, Y: y}, {X: pts[len(pts)-1].X, Y: y}})
+	if err != nil {
+		return err
+	}
+	line.Color = color.RGBA{R: 200, A: 255}
+	line.Dashes = []vg.Length{vg.Points(6), vg.Points(3)}
+	p.Add(line)
+	p.Legend.Add(label, line)
+	return nil
+}
+
+// addPeakLabel labels the highest point of pts with its value and the wall
+// clock time of the sample it came from. On normalized charts the label is
+// placed on the normalized point but still shows the raw value.
+func addPeakLabel(p *plot.Plot, pts plotter.XYs, measurements []Measurement, unit string, opts ChartOptions) error {
+	peak := -1
+	for i := range pts {
+		if isFinite(pts[i].Y) && (peak < 0 || pts[i].Y > pts[peak].Y) {
+			peak = i
+		}
+	}
+	if peak < 0 {
+		return nil
+	}
+	labels, err := plotter.NewLabels(plotter.XYLabels{
+		XYs:    []plotter.XY{opts.Normalize.apply(pts)[peak]},
+		Labels: []string{fmt.Sprintf("max %g%s at %s", pts[peak].Y, unit, measurements[peak].Timestamp.Format("15:04:05"))},
+	})
+	if err != nil {
+		return err
+	}
+	labels.Offset = vg.Point{X: vg.Points(4), Y: vg.Points(4)}
+	if opts.Palette != nil {
+		labels.TextStyle[0].Color = opts.Palette.Text
+	}
+	p.Add(labels)
+	return nil
+}
+
+// offset returns how long after first m was taken, on the monotonic clock
+// if both carry Measurement.Elapsed, or else by their timestamps.
+func offset(first, m *Measurement) time.Duration {
+	if first.Elapsed > 0 && m.Elapsed > 0 {
+		return m.Elapsed - first.Elapsed
+	}
+	return m.Timestamp.Sub(first.Timestamp)
+}
+
+// instantOffset returns how long after the first of measurements the
+// instant t was, on the same basis as offset: from the last measurement
+// taken at or before t, so that markers line up with the series even if
+// the wall clock was adjusted during the run.
+func instantOffset(measurements []Measurement, t time.Time) time.Duration {
+	i := max(sort.Search(len(measurements), func(i int) bool { return measurements[i].Timestamp.After(t) })-1, 0)
+	return offset(&measurements[0], &measurements[i]) + t.Sub(measurements[i].Timestamp)
+}
+
+// series returns the points of value over time, with X in seconds since the
+// first measurement. Failed and paused measurements have a NaN value,
+// leaving a gap.
+func series(measurements []Measurement, value func(Measurement) float64) plotter.XYs {
+	pts := make(plotter.XYs, len(measurements))
+	for i, m := range measurements {
+		pts[i].X = offset(&measurements[0], &m).Seconds()
+		pts[i].Y = value(m)
+		if m.Failed {
+			pts[i].Y = math.NaN()
+		}
+	}
+	return pts
+}
+
+// orGap returns v, or NaN if the query of v failed, leaving a gap.
+func orGap(v float64, failed bool) float64 {
+	if failed {
+		return math.NaN()
+	}
+	return v
+}
+
+// tableRows returns Measurement.TableRows, or NaN if its query failed.
+func tableRows(m Measurement) float64 {
+	return orGap(float64(m.TableRows), m.TableRowsFailed)
+}
+
+// perSecond returns the per-second rate of change from prevValue in prev to
+// value in cur, over the time actually elapsed between the two samples
+// rather than the interval, so that dropped samples and jitter do not skew
+// it. It reports false if no time elapsed.
+func perSecond(prev, cur *Measurement, prevValue, value float64) (float64, bool) {
+	elapsed := offset(prev, cur).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (value - prevValue) / elapsed, true
+}
+
+// rateSeries returns the per-second rate of change of value between
+// consecutive samples that collected it, see perSecond. Samples value
+// reports false for, e.g. failed ones, are skipped over, so that the rate is
+// taken across them. For a counter, a decrease means it was reset, e.g. by a
+// server restart, so no rate is computed across it. A pause leaves a gap.
+func rateSeries(measurements []Measurement, value func(Measurement) (float64, bool), counter bool) plotter.XYs {
+	pts := make(plotter.XYs, 0, len(measurements))
+	var prev *Measurement
+	var prevValue float64
+	for i := range measurements {
+		cur := &measurements[i]
+		if cur.Paused {
+			pts = append(pts, plotter.XY{X: offset(&measurements[0], cur).Seconds(), Y: math.NaN()})
+			prev = nil
+			continue
+		}
+		v, ok := value(*cur)
+		if !ok {
+			continue
+		}
+		if prev != nil && !(counter && v < prevValue) {
+			if rate, ok := perSecond(prev, cur, prevValue, v); ok {
+				pts = append(pts, plotter.XY{X: offset(&measurements[0], cur).Seconds(), Y: rate})
+			}
+		}
+		prev, prevValue = cur, v
+	}
+	return pts
+}
+
+// churnSeries returns the change in connections since the previous sample.
+// Failed samples carry no connection count, so the delta is taken across
+// them rather than dropping to zero and back.
+func churnSeries(measurements []Measurement) plotter.XYs {
+	pts := make(plotter.XYs, 0, len(measurements))
+	var prev *Measurement
+	for i := range measurements {
+		cur := &measurements[i]
+		if cur.Failed {
+			continue
+		}
+		if prev != nil {
+			pts = append(pts, plotter.XY{
+				X: offset(&measurements[0], cur).Seconds(),
+				Y: float64(cur.Connections - prev.Connections),
+			})
+		}
+		prev = cur
+	}
+	return pts
+}
+
+func newSubplot(title, yLabel string) *plot.Plot {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = "Time (seconds)"
+	p.Y.Label.Text = yLabel
+	return p
+}
+
+func generateChart(measurements []Measurement, opts ChartOptions) (*vgimg.Canvas, error) {
+	column, err := chartColumn(measurements, opts)
+	if err != nil {
+		return nil, err
+	}
+	return drawColumns([][]*plot.Plot{column}, opts), nil
+}
+
+// chartColumn returns the subplots of the chart of measurements, top to
+// bottom.
+func chartColumn(measurements []Measurement, opts ChartOptions) ([]*plot.Plot, error) {
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("no measurements to plot")
+	}
+	measurements, err := opts.Zoom.apply(measurements)
+	if err != nil {
+		return nil, err
+	}
+	measurements = tail(measurements, opts.Tail)
+	measurements = thin(measurements, opts.MaxSamples)
+
+	// Prepare data points
+	connectionPts := series(measurements, func(m Measurement) float64 { return float64(m.Connections) })
+	unit := opts.DurationUnit
+	durationPts := series(measurements, func(m Measurement) float64 { return orGap(unit.of(m.QueryDuration), m.Backfilled) })
+	p50Pts := series(measurements, func(m Measurement) float64 { return orGap(unit.of(m.QueryP50), m.Backfilled) })
+	p99Pts := series(measurements, func(m Measurement) float64 { return orGap(unit.of(m.QueryP99), m.Backfilled) })
+
+	// Create one subplot per row
+	var subplots []*plot.Plot
+
+	// Connections subplot
+	connections := newSubplot("Active Connections", "Number of Connections")
+	if opts.ServerAggregate {
+		avgPts := series(measurements, func(m Measurement) float64 { return m.ConnectionsAvg })
+		if err := addNamedSeries(connections, connectionPts, 0, "max", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(connections, avgPts, 1, "avg", opts); err != nil {
+			return nil, err
+		}
+	} else if opts.ConnectionSource == ConnectionsBoth {
+		queryPts := series(measurements, func(m Measurement) float64 { return orGap(float64(m.ActiveQueries), m.ActiveQueriesFailed) })
+		if err := addNamedSeries(connections, connectionPts, 0, "sockets (system.metrics)", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(connections, queryPts, 1, "queries (system.processes)", opts); err != nil {
+			return nil, err
+		}
+	} else if err := addSeries(connections, connectionPts, 0, opts); err != nil {
+		return nil, err
+	}
+	if opts.ConnectionSource == ConnectionsProcesses {
+		connections.Title.Text = "Active Queries (system.processes)"
+		connections.Y.Label.Text = "Number of Queries"
+	}
+	if opts.LabelPeaks {
+		if err := addPeakLabel(connections, connectionPts, measurements, "", opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.BaselineWindow > 0 {
+		if err := addBaseline(connections, connectionPts, opts.BaselineWindow, opts); err != nil {
+			return nil, err
+		}
+	}
+	// max_connections limits sockets, not queries
+	if opts.MaxConnections > 0 && opts.Normalize == NormalizeNone && opts.ConnectionSource != ConnectionsProcesses {
+		if err := addThreshold(connections, connectionPts, float64(opts.MaxConnections), "max_connections"); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Availability {
+		connections.Add(newAvailabilityBand(measurements))
+	}
+	subplots = append(subplots, connections)
+
+	// Query Duration subplot
+	duration := newSubplot("Query Duration", "Duration ("+unit.String()+")")
+	// Durations already have a unit, which a K suffix would only obscure
+	duration.Y.Tick.Marker = unitTicker{unit: AxisPlain}
+	if opts.QueryLogLatency {
+		duration.Title.Text = "Query Duration (system.query_log)"
+		p50, p99 := p50Pts, p99Pts
+		if opts.DedupeStale {
+			p50, p99 = dedupeRuns(p50), dedupeRuns(p99)
+		}
+		if err := addNamedSeries(duration, p50, 1, "p50", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(duration, p99, 2, "p99", opts); err != nil {
+			return nil, err
+		}
+	} else if err := addSeries(duration, durationPts, 1, opts); err != nil {
+		return nil, err
+	}
+	headlinePts := durationPts
+	if opts.QueryLogLatency {
+		headlinePts = p99Pts
+	}
+	if opts.LabelPeaks {
+		if err := addPeakLabel(duration, headlinePts, measurements, unit.String(), opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SLODuration > 0 && opts.Normalize == NormalizeNone {
+		if err := addSLO(duration, headlinePts, unit.of(opts.SLODuration)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.BaselineWindow > 0 {
+		if err := addBaseline(duration, headlinePts, opts.BaselineWindow, opts); err != nil {
+			return nil, err
+		}
+	}
+	subplots = append(subplots, duration)
+
+	// Optional per-bucket query_log percentiles subplot
+	if len(opts.QueryLogBuckets) > 0 {
+		buckets := newSubplot(fmt.Sprintf("Query Duration per %s (system.query_log)", opts.QueryLogBucket), "Duration ("+unit.String()+")")
+		buckets.Y.Tick.Marker = unitTicker{unit: AxisPlain}
+		if err := addPercentileBuckets(buckets, opts.QueryLogBuckets, opts.QueryLogBucket, measurements[0].Timestamp, measurements[len(measurements)-1].Timestamp, unit, opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, buckets)
+	}
+
+	// Optional Connection Churn subplot, drawn as steps since each delta
+	// covers a whole interval
+	if opts.ConnectionChurn {
+		churn := newSubplot("Connection Churn", "Change in Connections")
+		runs, _ := finiteRuns(opts.Normalize.apply(churnSeries(measurements)))
+		for _, run := range runs {
+			line, err := plotter.NewLine(run)
+			if err != nil {
+				return nil, err
+			}
+			line.StepStyle = plotter.PreStep
+			churn.Add(line)
+		}
+		subplots = append(subplots, churn)
+	}
+
+	// Optional Distinct Clients subplot
+	if opts.DistinctClients {
+		clients := newSubplot("Distinct Clients", "Number of Client Hosts")
+		clientPts := series(measurements, func(m Measurement) float64 { return orGap(float64(m.DistinctClients), m.DistinctClientsFailed) })
+		if err := addSeries(clients, clientPts, 2, opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, clients)
+	}
+
+	// Optional Watched Table subplots
+	if opts.WatchTable != "" {
+		// Failed samples, or queries of the table, carry no row count
+		collectedRows := func(m Measurement) (float64, bool) { return tableRows(m), !m.Failed && !m.TableRowsFailed }
+		title, yLabel := "Rows in "+opts.WatchTable, "Number of Rows"
+		rateTitle, rateLabel := "Insert Rate into "+opts.WatchTable, "Rows per Second"
+		if opts.WatchExpr != "" {
+			title, yLabel = opts.WatchExpr+" of "+opts.WatchTable, "Value"
+			rateTitle, rateLabel = "Rate of "+opts.WatchExpr+" of "+opts.WatchTable, "Per Second"
+		}
+		table := newSubplot(title, yLabel)
+		if err := addSeries(table, series(measurements, tableRows), 3, opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, table)
+
+		if opts.WatchTableRate {
+			rate := newSubplot(rateTitle, rateLabel)
+			if err := addSeries(rate, rateSeries(measurements, collectedRows, false), 4, opts); err != nil {
+				return nil, err
+			}
+			subplots = append(subplots, rate)
+		}
+	}
+
+	// Optional system.dashboards panel subplot
+	if opts.Dashboard != "" {
+		panel := newSubplot(opts.Dashboard, "Value")
+		if err := addSeries(panel, series(measurements, func(m Measurement) float64 { return orGap(m.DashboardValue, m.DashboardValueFailed) }), 5, opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, panel)
+	}
+
+	// Optional Keeper subplot
+	if opts.Keeper {
+		keeper := newSubplot("Keeper", "Count")
+		sessions := series(measurements, func(m Measurement) float64 { return orGap(float64(m.KeeperSessions), m.KeeperFailed) })
+		requests := series(measurements, func(m Measurement) float64 { return orGap(float64(m.KeeperRequests), m.KeeperFailed) })
+		if err := addNamedSeries(keeper, sessions, 0, "sessions", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(keeper, requests, 1, "in-flight requests", opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, keeper)
+	}
+
+	// Optional query queue subplot
+	if opts.QueryQueue {
+		queue := newSubplot("Query Queue", "Queries")
+		running := series(measurements, func(m Measurement) float64 { return orGap(float64(m.QueriesRunning), m.QueryQueueFailed) })
+		waiting := series(measurements, func(m Measurement) float64 { return orGap(float64(m.QueriesWaiting), m.QueryQueueFailed) })
+		if err := addNamedSeries(queue, running, 0, "running", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(queue, waiting, 1, "waiting (preempted)", opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, queue)
+	}
+
+	// Optional distributed insert backlog subplot
+	if opts.Distributed {
+		distributed := newSubplot("Distributed Inserts", "Count")
+		files := series(measurements, func(m Measurement) float64 { return orGap(float64(m.DistributedFilesToInsert), m.DistributedFailed) })
+		sends := series(measurements, func(m Measurement) float64 { return orGap(float64(m.DistributedSends), m.DistributedFailed) })
+		if err := addNamedSeries(distributed, files, 0, "files to insert (backlog)", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(distributed, sends, 1, "sends in flight", opts); err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, distributed)
+	}
+
+	// Optional ProfileEvents subplot
+	if len(opts.ProfileEvents) > 0 {
+		events := newSubplot("ProfileEvents", "Events per Second")
+		for i, event := range opts.ProfileEvents {
+			if err := addNamedSeries(events, rateSeries(measurements, profileEvent(event), true), i, event, opts); err != nil {
+				return nil, err
+			}
+		}
+		subplots = append(subplots, events)
+	}
+
+	if opts.CacheHitRates {
+		caches := newSubplot("Cache Hit Rate", "Hit Rate (%)")
+		caches.Y.Tick.Marker = unitTicker{unit: AxisPlain}
+		if err := addNamedSeries(caches, hitRateSeries(measurements, "MarkCacheHits", "MarkCacheMisses"), 0, "mark cache", opts); err != nil {
+			return nil, err
+		}
+		if err := addNamedSeries(caches, hitRateSeries(measurements, "UncompressedCacheHits", "UncompressedCacheMisses"), 1, "uncompressed cache", opts); err != nil {
+			return nil, err
+		}
+		if caches.Y.Min <= caches.Y.Max && opts.Normalize == NormalizeNone {
+			caches.Y.Min, caches.Y.Max = 0, 100
+		}
+		subplots = append(subplots, caches)
+	}
+
+	if opts.IOThroughput {
+		throughput := newSubplot("I/O Throughput", "Bytes per Second")
+		throughput.Y.Tick.Marker = unitTicker{unit: AxisBytes}
+		names := []string{"file read", "file write", "network receive", "network send"}
+		for i, event := range IOEvents {
+			if err := addNamedSeries(throughput, rateSeries(measurements, profileEvent(event), true), i, names[i], opts); err != nil {
+				return nil, err
+			}
+		}
+		subplots = append(subplots, throughput)
+	}
+
+	if len(opts.Metrics) > 0 {
+		metrics := newSubplot("Metrics", "Value")
+		for i, name := range opts.Metrics {
+			if err := addNamedSeries(metrics, metricSeries(measurements, name), i, name, opts); err != nil {
+				return nil, err
+			}
+		}
+		subplots = append(subplots, metrics)
+	}
+
+	var overview *plot.Plot
+	if opts.Overview {
+		overview, err = overviewPlot(measurements, opts)
+		if err != nil {
+			return nil, err
+		}
+		subplots = append([]*plot.Plot{overview}, subplots...)
+	}
+
+	restartXs := restarts(measurements)
+	runEnd := connectionPts[len(connectionPts)-1].X
+	for _, p := range subplots {
+		// No series added any data, so the axis ranges are still unset
+		noData := p.Y.Min > p.Y.Max
+		if noData {
+			if err := addNoData(p, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.MaxXTicks > 0 {
+			p.X.Tick.Marker = timeTicker{max: opts.MaxXTicks}
+		}
+		// The overview is normalized on its own
+		if p != overview {
+			p.Y.Label.Text = opts.Normalize.axisLabel(p.Y.Label.Text)
+		}
+		if unit, ok := opts.AxisUnits[p.Title.Text]; ok {
+			p.Y.Tick.Marker = unitTicker{unit: unit}
+		} else if _, ok := p.Y.Tick.Marker.(plot.DefaultTicks); ok && opts.Normalize == NormalizeNone {
+			p.Y.Tick.Marker = unitTicker{unit: AxisSI}
+		}
+		if opts.AnnotateRestarts {
+			for _, x := range restartXs {
+				p.Add(marker{X: x, Label: "restart", Color: restartColor})
+			}
+		}
+		for _, e := range opts.Events {
+			p.Add(marker{X: instantOffset(measurements, e.Time).Seconds(), Label: e.Label, Color: eventColor})
+		}
+		if opts.Zoom.From > 0 {
+			p.X.Label.Text = fmt.Sprintf("Time (seconds since %s)", opts.Zoom.From)
+		}
+		if opts.Tail > 0 {
+			p.X.Label.Text = fmt.Sprintf("Time (seconds, last %s)", opts.Tail)
+		}
+		grid := plotter.NewGrid()
+		if opts.Palette != nil {
+			opts.Palette.styleGrid(grid)
+		}
+		p.Add(grid)
+		// Every subplot spans the whole run, even where its series start
+		// late, e.g. rates, or overhang, e.g. query_log buckets, so that a
+		// moment lines up exactly through the stacked subplots
+		if !noData {
+			p.X.Min, p.X.Max = 0, runEnd
+		}
+	}
+
+	// The histogram and scatter plot go last, as they have no time axis
+	if opts.CompareMetric {
+		scatter, err := correlationPlot(measurements, unit, opts.Palette)
+		if err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, scatter)
+	}
+	if opts.LatencyHistogram {
+		edges := opts.LatencyBuckets
+		if len(edges) == 0 {
+			edges = DefaultLatencyBuckets
+		}
+		histogram, err := latencyHistogram(measurements, edges, opts.Palette)
+		if err != nil {
+			return nil, err
+		}
+		subplots = append(subplots, histogram)
+	}
+	if opts.Palette != nil {
+		for _, p := range subplots {
+			opts.Palette.style(p)
+		}
+	}
+	return subplots, nil
+}
+
+// drawColumns lays out columns of subplots side by side, with the subplots
+// of each row aligned, and draws them. Shorter columns leave their last
+// rows empty.
+func drawColumns(columns [][]*plot.Plot, opts ChartOptions) *vgimg.Canvas {
+	rows := 0
+	for _, column := range columns {
+		rows = max(rows, len(column))
+	}
+	cols := len(columns)
+	plots := make([][]*plot.Plot, rows)
+	for j := range plots {
+		plots[j] = make([]*plot.Plot, cols)
+		for i, column := range columns {
+			if j < len(column) {
+				plots[j][i] = column[j]
+			}
+		}
+	}
+
+	// Create the image
+	dpi := opts.DPI
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	var background color.Color = color.White
+	if opts.Palette != nil {
+		background = opts.Palette.Background
+	}
+	if opts.Transparent {
+		// Every plot paints its own background over the canvas's
+		background = color.Transparent
+		for _, row := range plots {
+			for _, p := range row {
+				if p != nil {
+					p.BackgroundColor = color.Transparent
+				}
+			}
+		}
+	}
+	width, height := vg.Points(800*1.5*float64(cols)), vg.Points(800*float64(rows))
+	if opts.Width > 0 {
+		scaled := vg.Length(opts.Width) * vg.Inch / vg.Length(dpi)
+		width, height = scaled, height*scaled/width
+	}
+	img := vgimg.NewWith(
+		vgimg.UseWH(width, height),
+		vgimg.UseDPI(dpi),
+		vgimg.UseBackgroundColor(background),
+	)
+	dc := draw.New(img)
+
+	// Configure tiles
+	t := draw.Tiles{
+		Rows:      rows,
+		Cols:      cols,
+		PadX:      vg.Millimeter,
+		PadY:      vg.Millimeter,
+		PadTop:    vg.Points(10),
+		PadBottom: vg.Points(10),
+		PadLeft:   vg.Points(10),
+		PadRight:  vg.Points(10),
+	}
+
+	// Draw the plots
+	canvases := plot.Align(plots, t, dc)
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			if plots[j][i] != nil {
+				plots[j][i].Draw(canvases[j][i])
+			}
+		}
+	}
+
+	return img
+}
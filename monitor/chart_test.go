@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateSeries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// sample is a measurement s seconds in with the value v, or a failed one
+	// if v is negative
+	sample := func(s, v int) Measurement {
+		m := Measurement{Timestamp: start.Add(time.Duration(s) * time.Second), Failed: v < 0}
+		if !m.Failed {
+			m.ProfileEvents = map[string]uint64{"SelectQuery": uint64(v)}
+		}
+		return m
+	}
+	paused := func(s int) Measurement {
+		return Measurement{Timestamp: start.Add(time.Duration(s) * time.Second), Failed: true, Paused: true}
+	}
+	value := func(m Measurement) (float64, bool) {
+		v, ok := m.ProfileEvents["SelectQuery"]
+		return float64(v), ok
+	}
+	nan := math.NaN()
+	tests := []struct {
+		name         string
+		measurements []Measurement
+		counter      bool
+		want         []float64
+	}{
+		{"empty", nil, true, nil},
+		{"one sample", []Measurement{sample(0, 5)}, true, nil},
+		{"steady", []Measurement{sample(0, 0), sample(1, 10), sample(3, 30)}, true, []float64{10, 10}},
+		{"counter reset", []Measurement{sample(0, 100), sample(1, 110), sample(2, 5), sample(3, 15)}, true, []float64{10, 10}},
+		{"gauge decrease", []Measurement{sample(0, 100), sample(2, 80)}, false, []float64{-10}},
+		{"across a failed sample", []Measurement{sample(0, 0), sample(1, -1), sample(2, 20)}, true, []float64{10}},
+		{"pause gap", []Measurement{sample(0, 0), sample(1, 10), paused(2), paused(10), sample(11, 100), sample(12, 110)}, true, []float64{10, nan, nan, 10}},
+		{"zero elapsed time", []Measurement{sample(0, 0), sample(0, 10), sample(1, 20)}, true, []float64{10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pts := rateSeries(tt.measurements, value, tt.counter)
+			if len(pts) != len(tt.want) {
+				t.Fatalf("rateSeries = %v, want %v", pts, tt.want)
+			}
+			for i, pt := range pts {
+				if want := tt.want[i]; math.IsNaN(want) != math.IsNaN(pt.Y) || !math.IsNaN(want) && pt.Y != want {
+					t.Errorf("rateSeries = %v, want %v", pts, tt.want)
+				}
+			}
+		})
+	}
+}
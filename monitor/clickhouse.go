@@ -0,0 +1,268 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// ClickHouseSource is the MetricSource of a ClickHouse server, running the
+// queries that the Options select. A Monitor created with New samples one,
+// keeping the fields of each Measurement, and it can also be used on its
+// own, e.g. to chart a second server's metrics next to another source.
+type ClickHouseSource struct {
+	conn driver.Conn
+	opts Options
+	// queries numbers the queries run, for their query_id.
+	queries atomic.Uint64
+}
+
+// NewClickHouseSource returns the MetricSource of the server of conn, with
+// the queries selected by opts.
+func NewClickHouseSource(conn driver.Conn, opts Options) *ClickHouseSource {
+	return &ClickHouseSource{conn: conn, opts: opts.withDefaults()}
+}
+
+// Collect runs the queries of one sample and returns their values, see
+// Measurement.Values. Like for a Monitor, only the connections query failing
+// fails the sample, and other query errors are logged.
+func (s *ClickHouseSource) Collect(ctx context.Context) (map[string]float64, error) {
+	var failed error
+	measurement := s.measure(ctx, func(name string, err error) {
+		switch {
+		case err == nil:
+		case name == connectionsStep:
+			failed = err
+		default:
+			log.Printf("Error querying %s: %v", name, err)
+		}
+	})
+	if measurement.Failed {
+		return nil, failed
+	}
+	return measurement.Values(s.opts), nil
+}
+
+// queryContext returns ctx with the query_id for the next query, if
+// Options.RunID is set.
+func (s *ClickHouseSource) queryContext(ctx context.Context) context.Context {
+	if s.opts.RunID == "" {
+		return ctx
+	}
+	return clickhouse.Context(ctx, clickhouse.WithQueryID(fmt.Sprintf("%s-%d", s.opts.RunID, s.queries.Add(1))))
+}
+
+// table returns the system table to query, on Options.Remote if set.
+func (s *ClickHouseSource) table(name string) string {
+	if s.opts.Remote != nil {
+		return s.opts.Remote.table(s.opts.SystemDB, name)
+	}
+	return systemTable(s.opts.SystemDB, name)
+}
+
+// measure takes a single measurement, reporting the outcome of every query
+// to report. It leaves Measurement.Elapsed to the Monitor.
+func (s *ClickHouseSource) measure(ctx context.Context, report func(name string, err error)) Measurement {
+	start := time.Now()
+
+	var count number
+	query := "SELECT sum(value) FROM " + s.table("metrics") + " WHERE metric IN ('TCPConnection', 'HTTPConnection');"
+	if s.opts.ConnectionSource == ConnectionsProcesses {
+		query = "SELECT toInt64(count()) FROM " + s.table("processes") + ";"
+	}
+	err := s.conn.QueryRow(s.queryContext(ctx), query).Scan(&count)
+	if err == nil && !count.valid {
+		// A gap, like a failed query, rather than zero connections
+		err = errNull
+	}
+	report(connectionsStep, err)
+	if err != nil {
+		return failedMeasurement(start)
+	}
+
+	duration := time.Since(start)
+
+	measurement := Measurement{
+		Timestamp:     start,
+		Connections:   count.int(),
+		QueryDuration: duration,
+		RoundTrip:     duration,
+	}
+
+	if s.opts.ConnectionSource == ConnectionsBoth {
+		var queries uint64
+		err := s.conn.QueryRow(s.queryContext(ctx), "SELECT count() FROM "+s.table("processes")+";").Scan(&queries)
+		report("active queries", err)
+		if err == nil {
+			measurement.ActiveQueries = int(queries)
+		} else {
+			measurement.ActiveQueriesFailed = true
+		}
+	}
+
+	if s.opts.CountDistinctClients {
+		var clients uint64
+		err := s.conn.QueryRow(s.queryContext(ctx), "SELECT uniqExact(client_hostname) FROM "+s.table("processes")+";").Scan(&clients)
+		report("distinct clients", err)
+		if err == nil {
+			measurement.DistinctClients = int(clients)
+		} else {
+			measurement.DistinctClientsFailed = true
+		}
+	}
+
+	if s.opts.QueryLogLatency {
+		var p50, p99 float64
+		exclude, args := s.opts.QueryLogExclude.withRunID(s.opts.RunID).where()
+		query := fmt.Sprintf(`
+			SELECT quantile(0.5)(query_duration_ms), quantile(0.99)(query_duration_ms)
+			FROM %s
+			WHERE event_time_microseconds > now64(6) - toIntervalMillisecond(%d)
+				AND type = 'QueryFinish'
+				%s;`, s.table("query_log"), s.opts.QueryLogWindow.Milliseconds(), exclude)
+		err := s.conn.QueryRow(s.queryContext(ctx), query, args...).Scan(&p50, &p99)
+		report("query_log latencies", err)
+		if err == nil && !math.IsNaN(p50) {
+			measurement.QueryP50 = time.Duration(p50 * float64(time.Millisecond))
+			measurement.QueryP99 = time.Duration(p99 * float64(time.Millisecond))
+		}
+	}
+
+	if s.opts.WatchTable != "" {
+		var rows number
+		table := quoteTable(s.opts.WatchTable)
+		if s.opts.Remote != nil {
+			db, name, _ := strings.Cut(s.opts.WatchTable, ".")
+			table = s.opts.Remote.table(db, name)
+		}
+		if s.opts.WatchFinal {
+			table += " FINAL"
+		}
+		expr, step := "count()", "the row count of "+s.opts.WatchTable
+		if s.opts.WatchExpr != "" {
+			expr, step = s.opts.WatchExpr, s.opts.WatchExpr+" of "+s.opts.WatchTable
+		}
+		err := s.conn.QueryRow(s.queryContext(ctx), "SELECT "+expr+" FROM "+table+";").Scan(&rows)
+		report(step, err)
+		if err == nil {
+			measurement.TableRows = rows.uint64()
+		} else {
+			measurement.TableRowsFailed = true
+		}
+	}
+
+	if s.opts.DashboardQuery != "" {
+		value, err := s.dashboardValue(ctx)
+		report("dashboard panel", err)
+		if err == nil {
+			measurement.DashboardValue = value
+		} else {
+			measurement.DashboardValueFailed = true
+		}
+	}
+
+	if len(s.opts.Series) > 0 {
+		measurement.Metrics = s.series(ctx, report)
+	}
+
+	if s.opts.Keeper {
+		var sessions, requests number
+		err := s.conn.QueryRow(s.queryContext(ctx), `
+			SELECT sumIf(value, metric = 'ZooKeeperSession'), sumIf(value, metric = 'ZooKeeperRequest')
+			FROM `+s.table("metrics")+`;`).Scan(&sessions, &requests)
+		report("Keeper metrics", err)
+		if err == nil {
+			measurement.KeeperSessions = sessions.int()
+			measurement.KeeperRequests = requests.int()
+		} else {
+			measurement.KeeperFailed = true
+		}
+	}
+
+	if s.opts.Uptime {
+		var uptime number
+		query := "SELECT uptime();"
+		if s.opts.Remote != nil {
+			// uptime() would be the relaying server's
+			query = "SELECT value FROM " + s.table("asynchronous_metrics") + " WHERE metric = 'Uptime';"
+		}
+		err := s.conn.QueryRow(s.queryContext(ctx), query).Scan(&uptime)
+		report("uptime", err)
+		if err == nil && uptime.valid {
+			measurement.Uptime = time.Duration(uptime.uint64()) * time.Second
+		}
+	}
+
+	if s.opts.QueryQueue {
+		// sumIf yields 0 for a metric the server does not have
+		var running, waiting number
+		err := s.conn.QueryRow(s.queryContext(ctx), `
+			SELECT sumIf(value, metric = 'Query'), sumIf(value, metric = 'QueryPreempted')
+			FROM `+s.table("metrics")+`;`).Scan(&running, &waiting)
+		report("the query queue", err)
+		if err == nil {
+			measurement.QueriesRunning = running.int()
+			measurement.QueriesWaiting = waiting.int()
+		} else {
+			measurement.QueryQueueFailed = true
+		}
+	}
+
+	if s.opts.Distributed {
+		var sends, files number
+		err := s.conn.QueryRow(s.queryContext(ctx), `
+			SELECT sumIf(value, metric = 'DistributedSend'), sumIf(value, metric = 'DistributedFilesToInsert')
+			FROM `+s.table("metrics")+`;`).Scan(&sends, &files)
+		report("the distributed insert backlog", err)
+		if err == nil {
+			measurement.DistributedSends = sends.int()
+			measurement.DistributedFilesToInsert = files.int()
+		} else {
+			measurement.DistributedFailed = true
+		}
+	}
+
+	if len(s.opts.ProfileEvents) > 0 {
+		events, err := s.profileEvents(ctx)
+		report("ProfileEvents", err)
+		if err == nil {
+			measurement.ProfileEvents = events
+		}
+	}
+
+	return measurement
+}
+
+// profileEvents returns the current value of each of Options.ProfileEvents.
+// Counters that were never incremented are missing from system.events and
+// reported as zero, like NULL values.
+func (s *ClickHouseSource) profileEvents(ctx context.Context) (map[string]uint64, error) {
+	rows, err := s.conn.Query(s.queryContext(ctx), "SELECT event, value FROM "+s.table("events")+" WHERE event IN (?);", s.opts.ProfileEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make(map[string]uint64, len(s.opts.ProfileEvents))
+	for _, event := range s.opts.ProfileEvents {
+		events[event] = 0
+	}
+	for rows.Next() {
+		var (
+			event string
+			value number
+		)
+		if err := rows.Scan(&event, &value); err != nil {
+			return nil, err
+		}
+		events[event] = value.uint64()
+	}
+	return events, rows.Err()
+}
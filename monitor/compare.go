@@ -0,0 +1,29 @@
+package monitor
+
+// Comparison holds how a run compares with a baseline run, as deltas in
+// percent of the baseline, positive when the run is worse.
+type Comparison struct {
+	BaselineQueryDurationP99 float64 `json:"baseline_query_duration_p99_ms"`
+	QueryDurationP99Delta    float64 `json:"query_duration_p99_delta_pct"`
+	BaselinePeakConnections  int     `json:"baseline_peak_connections"`
+	PeakConnectionsDelta     float64 `json:"peak_connections_delta_pct"`
+}
+
+// Compare compares summary with baseline, the summary of a known-good run.
+func Compare(summary, baseline Summary) Comparison {
+	return Comparison{
+		BaselineQueryDurationP99: baseline.QueryDurationP99,
+		QueryDurationP99Delta:    deltaPercent(summary.QueryDurationP99, baseline.QueryDurationP99),
+		BaselinePeakConnections:  baseline.PeakConnections,
+		PeakConnectionsDelta:     deltaPercent(float64(summary.PeakConnections), float64(baseline.PeakConnections)),
+	}
+}
+
+// deltaPercent is the change from base to v in percent of base, or 0 if
+// base is 0, as nothing can be said relative to it.
+func deltaPercent(v, base float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return 100 * (v - base) / base
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// correlationPlot returns a scatter plot of each sample's query duration
+// against its connection count, with the least-squares regression line and
+// the Pearson correlation coefficient in the title. Failed samples, and
+// backfilled ones, which have no query duration, are left out.
+func correlationPlot(measurements []Measurement, unit DurationUnit, palette *Palette) (*plot.Plot, error) {
+	var pts plotter.XYs
+	for _, m := range measurements {
+		if m.Failed || m.Backfilled {
+			continue
+		}
+		pts = append(pts, plotter.XY{X: float64(m.Connections), Y: unit.of(m.QueryDuration)})
+	}
+
+	p := plot.New()
+	p.Title.Text = "Query Duration vs Connections"
+	p.X.Label.Text = "Number of Connections"
+	p.Y.Label.Text = "Duration (" + unit.String() + ")"
+	grid := plotter.NewGrid()
+	if palette != nil {
+		palette.styleGrid(grid)
+	}
+	p.Add(grid)
+	if len(pts) == 0 {
+		return p, nil
+	}
+
+	scatter, err := plotter.NewScatter(pts)
+	if err != nil {
+		return nil, err
+	}
+	scatter.GlyphStyle.Radius = vg.Points(2)
+	if palette != nil {
+		scatter.GlyphStyle.Color = palette.series(0)
+	}
+	p.Add(scatter)
+
+	slope, intercept, r, ok := regression(pts)
+	if !ok {
+		return p, nil
+	}
+	p.Title.Text += fmt.Sprintf(" (r = %.2f)", r)
+	minX, maxX := pts[0].X, pts[0].X
+	for _, pt := range pts {
+		minX, maxX = math.Min(minX, pt.X), math.Max(maxX, pt.X)
+	}
+	line, err := plotter.NewLine(plotter.XYs{{X: minX, Y: intercept + slope*minX}, {X: maxX, Y: intercept + slope*maxX}})
+	if err != nil {
+		return nil, err
+	}
+	line.Color = plotutil.Color(1)
+	if palette != nil {
+		line.Color = palette.series(1)
+	}
+	p.Add(line)
+	return p, nil
+}
+
+// regression returns the least-squares fit y = slope*x + intercept of pts
+// and their Pearson correlation coefficient. ok is false if either
+// coordinate is constant, as neither is defined then.
+func regression(pts plotter.XYs) (slope, intercept, r float64, ok bool) {
+	n := float64(len(pts))
+	var sumX, sumY float64
+	for _, pt := range pts {
+		sumX += pt.X
+		sumY += pt.Y
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, syy, sxy float64
+	for _, pt := range pts {
+		dx, dy := pt.X-meanX, pt.Y-meanY
+		sxx += dx * dx
+		syy += dy * dy
+		sxy += dx * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, 0, 0, false
+	}
+	slope = sxy / sxx
+	return slope, meanY - slope*meanX, sxy / math.Sqrt(sxx*syy), true
+}
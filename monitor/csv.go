@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// csvHeader is the header row of the CSV outputs.
+var csvHeader = []string{
+	"timestamp", "connections", "query_duration_ns", "distinct_clients",
+	"query_p50_ns", "query_p99_ns", "table_rows", "dashboard_value",
+	"failed", "round_trip_ns",
+}
+
+// csvRecord formats m as a CSV row matching csvHeader. The values whose
+// query failed are left empty, and so are the durations of backfilled
+// measurements.
+func csvRecord(m Measurement) []string {
+	unless := func(failed bool, v string) string {
+		if failed {
+			return ""
+		}
+		return v
+	}
+	return []string{
+		m.Timestamp.Format(time.RFC3339Nano),
+		strconv.Itoa(m.Connections),
+		unless(m.Backfilled, strconv.FormatInt(int64(m.QueryDuration), 10)),
+		unless(m.DistinctClientsFailed, strconv.Itoa(m.DistinctClients)),
+		unless(m.Backfilled, strconv.FormatInt(int64(m.QueryP50), 10)),
+		unless(m.Backfilled, strconv.FormatInt(int64(m.QueryP99), 10)),
+		unless(m.TableRowsFailed, strconv.FormatUint(m.TableRows, 10)),
+		unless(m.DashboardValueFailed, strconv.FormatFloat(m.DashboardValue, 'g', -1, 64)),
+		strconv.FormatBool(m.Failed),
+		unless(m.Backfilled, strconv.FormatInt(int64(m.RoundTrip), 10)),
+	}
+}
+
+// WriteCSV writes the raw measurements as CSV with a header row, with
+// durations in nanoseconds.
+func WriteCSV(w io.Writer, measurements []Measurement) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, m := range measurements {
+		cw.Write(csvRecord(m))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVSink is a Sink that writes each measurement as a CSV row as soon as it
+// is collected, in the format of WriteCSV, for streaming consumers.
+type CSVSink struct {
+	mu     sync.Mutex
+	cw     *csv.Writer
+	header bool
+}
+
+// NewCSVSink returns a CSVSink writing to w. The header row is written with
+// the first measurement.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{cw: csv.NewWriter(w)}
+}
+
+func (s *CSVSink) Write(m Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		s.cw.Write(csvHeader)
+		s.header = true
+	}
+	s.cw.Write(csvRecord(m))
+	s.cw.Flush()
+	return s.cw.Error()
+}
+
+// ReadCSV reads measurements written by WriteCSV or CSVSink. Columns are
+// matched by their header, so files written before a column was added can
+// still be read; only timestamp, connections and query_duration_ns are
+// required. An empty value of a column that is there is one whose query
+// failed, or for query_duration_ns, one of a backfilled measurement.
+func ReadCSV(r io.Reader) ([]Measurement, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty CSV")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"timestamp", "connections", "query_duration_ns"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+
+	measurements := make([]Measurement, 0, len(records)-1)
+	for line, record := range records[1:] {
+		var m Measurement
+		var err error
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		integer := func(name string) int64 {
+			v := field(name)
+			if v == "" || err != nil {
+				return 0
+			}
+			var n int64
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				err = fmt.Errorf("%s: %w", name, err)
+			}
+			return n
+		}
+		unsigned := func(name string) uint64 {
+			v := field(name)
+			if v == "" || err != nil {
+				return 0
+			}
+			var n uint64
+			if n, err = strconv.ParseUint(v, 10, 64); err != nil {
+				err = fmt.Errorf("%s: %w", name, err)
+			}
+			return n
+		}
+		if m.Timestamp, err = time.Parse(time.RFC3339Nano, field("timestamp")); err != nil {
+			return nil, fmt.Errorf("line %d: timestamp: %w", line+2, err)
+		}
+		m.Connections = int(integer("connections"))
+		m.QueryDuration = time.Duration(integer("query_duration_ns"))
+		m.DistinctClients = int(integer("distinct_clients"))
+		m.QueryP50 = time.Duration(integer("query_p50_ns"))
+		m.QueryP99 = time.Duration(integer("query_p99_ns"))
+		m.TableRows = unsigned("table_rows")
+		m.RoundTrip = time.Duration(integer("round_trip_ns"))
+		empty := func(name string) bool {
+			_, ok := columns[name]
+			return ok && field(name) == ""
+		}
+		m.Backfilled = empty("query_duration_ns")
+		m.DistinctClientsFailed = empty("distinct_clients")
+		m.TableRowsFailed = empty("table_rows")
+		m.DashboardValueFailed = empty("dashboard_value")
+		if v := field("dashboard_value"); v != "" && err == nil {
+			if m.DashboardValue, err = strconv.ParseFloat(v, 64); err != nil {
+				err = fmt.Errorf("dashboard_value: %w", err)
+			}
+		}
+		if v := field("failed"); v != "" && err == nil {
+			if m.Failed, err = strconv.ParseBool(v); err != nil {
+				err = fmt.Errorf("failed: %w", err)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+2, err)
+		}
+		measurements = append(measurements, m)
+	}
+	return measurements, nil
+}
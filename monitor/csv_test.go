@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	const header = "timestamp,connections,query_duration_ns,distinct_clients,query_p50_ns,query_p99_ns,table_rows,dashboard_value,failed,round_trip_ns\n"
+	tests := []struct {
+		name  string
+		in    string
+		count int
+		ok    bool
+	}{
+		{"empty", "", 0, false},
+		{"header only", header, 0, true},
+		{"row", header + "2024-01-01T00:00:01Z,3,1000,0,0,0,0,0,false,2000\n", 1, true},
+		{"older columns", "timestamp,connections,query_duration_ns\n2024-01-01T00:00:01Z,3,1000\n", 1, true},
+		{"reordered columns", "connections,timestamp,query_duration_ns\n3,2024-01-01T00:00:01Z,1000\n", 1, true},
+		{"missing column", "timestamp,connections\n2024-01-01T00:00:01Z,3\n", 0, false},
+		{"truncated row", header + "2024-01-01T00:00:01Z,3,1000,0,0,0,0,0,false,2000\n2024-01-01T00:00:02Z,3,10", 0, false},
+		{"truncated timestamp", "timestamp,connections,query_duration_ns\n2024-01-01T00:0,3,1000\n", 0, false},
+		{"unterminated quote", header + "\"2024-01-01T00:00:01Z,3,1000,0,0,0,0,0,false,2000\n", 0, false},
+		{"invalid number", header + "2024-01-01T00:00:01Z,three,1000,0,0,0,0,0,false,2000\n", 0, false},
+		{"invalid bool", header + "2024-01-01T00:00:01Z,3,1000,0,0,0,0,0,maybe,2000\n", 0, false},
+		{"negative table rows", header + "2024-01-01T00:00:01Z,3,1000,0,0,0,-1,0,false,2000\n", 0, false},
+		{"invalid float", header + "2024-01-01T00:00:01Z,3,1000,0,0,0,0,much,false,2000\n", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(tt.in))
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("ReadCSV = %d measurements, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSV: %v", err)
+			}
+			if len(got) != tt.count {
+				t.Errorf("ReadCSV = %d measurements, want %d", len(got), tt.count)
+			}
+		})
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []Measurement{
+		{Timestamp: start, Connections: 3, QueryDuration: time.Millisecond, DistinctClients: 2, TableRows: 1<<63 + 1, DashboardValue: 0.5, RoundTrip: 2 * time.Millisecond},
+		{Timestamp: start.Add(time.Second), Failed: true, RoundTrip: time.Second},
+		{Timestamp: start.Add(2 * time.Second), Connections: 4, DistinctClientsFailed: true, TableRowsFailed: true, DashboardValueFailed: true},
+		{Timestamp: start.Add(3 * time.Second), Connections: 5, Backfilled: true},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d measurements, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) {
+			t.Errorf("measurement %d at %s, want %s", i, got[i].Timestamp, want[i].Timestamp)
+		}
+		got[i].Timestamp = want[i].Timestamp
+		if !flat(got[i], want[i]) || got[i].QueryDuration != want[i].QueryDuration || got[i].RoundTrip != want[i].RoundTrip {
+			t.Errorf("measurement %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// dashboardSeconds and dashboardRounding fill the {seconds} and {rounding}
+// parameters of system.dashboards queries: the window they cover and the
+// size of the time buckets within it.
+const (
+	dashboardSeconds  = 60
+	dashboardRounding = 1
+)
+
+// DashboardQuery returns the query of the system.dashboards panel titled
+// title, preferring the Overview dashboard if several panels share it.
+// It fails on servers older than 23.5, which lack system.dashboards. The
+// panel queries themselves read from the system database as written by the
+// server, whatever systemDB is.
+func DashboardQuery(ctx context.Context, conn driver.Conn, systemDB, title string) (string, error) {
+	var query string
+	err := conn.QueryRow(ctx, "SELECT query FROM "+systemTable(systemDB, "dashboards")+" WHERE title = ? ORDER BY dashboard != 'Overview' LIMIT 1;", title).Scan(&query)
+	if err != nil {
+		return "", fmt.Errorf("dashboard panel %q not found: %v", title, err)
+	}
+	return query, nil
+}
+
+// dashboardValue runs a system.dashboards query, which returns a
+// (time, value) row per time bucket, and returns the most recent value.
+func (s *ClickHouseSource) dashboardValue(ctx context.Context) (float64, error) {
+	ctx = clickhouse.Context(ctx, clickhouse.WithParameters(clickhouse.Parameters{
+		"seconds":  fmt.Sprint(dashboardSeconds),
+		"rounding": fmt.Sprint(dashboardRounding),
+	}))
+	rows, err := s.conn.Query(s.queryContext(ctx), s.opts.DashboardQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Column types differ between panels, so scan into whatever each reports
+	columns := rows.ColumnTypes()
+	if len(columns) < 2 {
+		return 0, fmt.Errorf("expected (time, value) rows, got %d columns", len(columns))
+	}
+	values := make([]any, len(columns))
+	for i, c := range columns {
+		values[i] = reflect.New(c.ScanType()).Interface()
+	}
+
+	var last float64
+	found := false
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return 0, err
+		}
+		if v, ok := toFloat(reflect.ValueOf(values[len(values)-1]).Elem()); ok {
+			last, found = v, true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("dashboard query returned no numeric values")
+	}
+	return last, nil
+}
+
+// toFloat converts a scanned numeric value, possibly behind a pointer for
+// Nullable columns, to float64. It reports false for NULL and non-numbers.
+func toFloat(v reflect.Value) (float64, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// DefaultDebugDumpEvery is the sampling of Options.DebugDump when
+// Options.DebugDumpEvery is zero.
+const DefaultDebugDumpEvery = 20
+
+// DumpRecord is a query recorded by Options.DebugDump, one per JSON line.
+// Non-finite floats are recorded as strings, e.g. "NaN", as JSON has no
+// literal for them.
+type DumpRecord struct {
+	// Time is when the query started.
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Query    string        `json:"query"`
+	Args     []any         `json:"args,omitempty"`
+	// Rows are the values scanned, one slice per row.
+	Rows  [][]any `json:"rows"`
+	Error string  `json:"error,omitempty"`
+}
+
+// dumper writes the queries of every Nth tick as DumpRecords, with the
+// password of Options.Remote redacted.
+type dumper struct {
+	w      io.Writer
+	every  uint64
+	remote *Remote
+	ticks  atomic.Uint64
+	// sampled is whether the queries of the current tick are recorded.
+	sampled atomic.Bool
+	mu      sync.Mutex
+	failed  bool
+}
+
+// tick starts the next tick, recording its queries if it is sampled.
+func (d *dumper) tick() {
+	if d == nil {
+		return
+	}
+	d.sampled.Store((d.ticks.Add(1)-1)%d.every == 0)
+}
+
+// write writes record, logging the first error only so that a full disk
+// does not flood the logs.
+func (d *dumper) write(record *DumpRecord) {
+	record.Query = d.remote.Redact(record.Query)
+	record.Error = d.remote.Redact(record.Error)
+	b, err := json.Marshal(record)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		_, err = d.w.Write(append(b, '\n'))
+	}
+	if err != nil && !d.failed {
+		d.failed = true
+		log.Printf("Error writing debug dump: %v", err)
+	}
+}
+
+// dumpConn records the queries of sampled ticks as they are scanned.
+type dumpConn struct {
+	driver.Conn
+	dump *dumper
+}
+
+func (c *dumpConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	if !c.dump.sampled.Load() {
+		return c.Conn.QueryRow(ctx, query, args...)
+	}
+	record := DumpRecord{Time: time.Now(), Query: query, Args: args}
+	return &dumpRow{Row: c.Conn.QueryRow(ctx, query, args...), dump: c.dump, record: record}
+}
+
+func (c *dumpConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	if !c.dump.sampled.Load() {
+		return c.Conn.Query(ctx, query, args...)
+	}
+	record := DumpRecord{Time: time.Now(), Query: query, Args: args}
+	rows, err := c.Conn.Query(ctx, query, args...)
+	if err != nil {
+		record.Duration = time.Since(record.Time)
+		record.Error = err.Error()
+		c.dump.write(&record)
+		return nil, err
+	}
+	return &dumpRows{Rows: rows, dump: c.dump, record: record}, nil
+}
+
+type dumpRow struct {
+	driver.Row
+	dump   *dumper
+	record DumpRecord
+}
+
+func (r *dumpRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	r.record.Duration = time.Since(r.record.Time)
+	if err != nil {
+		r.record.Error = err.Error()
+	} else {
+		r.record.Rows = [][]any{scannedValues(dest)}
+	}
+	r.dump.write(&r.record)
+	return err
+}
+
+// dumpRows records its rows once closed.
+type dumpRows struct {
+	driver.Rows
+	dump   *dumper
+	record DumpRecord
+	closed bool
+}
+
+func (r *dumpRows) Scan(dest ...any) error {
+	err := r.Rows.Scan(dest...)
+	if err == nil {
+		r.record.Rows = append(r.record.Rows, scannedValues(dest))
+	}
+	return err
+}
+
+func (r *dumpRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.record.Duration = time.Since(r.record.Time)
+		if rowsErr := r.Rows.Err(); rowsErr != nil {
+			r.record.Error = rowsErr.Error()
+		}
+		r.dump.write(&r.record)
+	}
+	return err
+}
+
+// scannedValues returns the values dest points to.
+func scannedValues(dest []any) []any {
+	values := make([]any, len(dest))
+	for i, d := range dest {
+		v := reflect.ValueOf(d)
+		if v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		values[i] = v.Interface()
+		if v.CanFloat() && (math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0)) {
+			values[i] = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+		}
+	}
+	return values
+}
@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// eventColor is the color of the event markers.
+var eventColor = color.RGBA{R: 200, G: 110, A: 255}
+
+// Event is something that happened during a run, e.g. a deploy, marked on
+// the chart with ChartOptions.Events.
+type Event struct {
+	Time  time.Time
+	Label string
+}
+
+var (
+	eventTimeType  = regexp.MustCompile(`^(LowCardinality\()?(Nullable\()?(DateTime|DateTime64|Date|Date32)\b`)
+	eventLabelType = regexp.MustCompile(`^(LowCardinality\()?(Nullable\()?(String|FixedString)\b`)
+)
+
+// CheckEventsQuery returns an error unless query, an events query for
+// QueryEvents, runs and returns exactly a timestamp and a string column.
+// It reads no rows.
+func CheckEventsQuery(ctx context.Context, conn driver.Conn, query string) error {
+	rows, err := conn.Query(ctx, "SELECT * FROM ("+strings.TrimSuffix(strings.TrimSpace(query), ";")+") LIMIT 0;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err := checkEventColumns(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+func checkEventColumns(rows driver.Rows) error {
+	columns := rows.ColumnTypes()
+	if len(columns) != 2 {
+		return fmt.Errorf("the query must return 2 columns, a timestamp and a label, got %d", len(columns))
+	}
+	if name := columns[0].DatabaseTypeName(); !eventTimeType.MatchString(name) {
+		return fmt.Errorf("the first column must be a DateTime, DateTime64 or Date, got %s", name)
+	}
+	if name := columns[1].DatabaseTypeName(); !eventLabelType.MatchString(name) {
+		return fmt.Errorf("the second column must be a String, got %s", name)
+	}
+	return nil
+}
+
+// QueryEvents runs query, which returns the time and the label of each
+// event, and returns the events between from and to. Times are compared as
+// instants, so the events line up with the measurements whatever the
+// timezones of the columns or of the monitor; a DateTime without one is in
+// the server's timezone, as ClickHouse reads it. Rows with a NULL time are
+// skipped, and a NULL label is empty.
+func QueryEvents(ctx context.Context, conn driver.Conn, query string, from, to time.Time) ([]Event, error) {
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if err := checkEventColumns(rows); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for rows.Next() {
+		var t *time.Time
+		var label *string
+		if err := rows.Scan(&t, &label); err != nil {
+			return nil, err
+		}
+		if t == nil || t.Before(from) || t.After(to) {
+			continue
+		}
+		e := Event{Time: *t}
+		if label != nil {
+			e.Label = *label
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// Facet is the series of one server in a faceted chart.
+type Facet struct {
+	// Name titles the facet's subplots, e.g. the server address.
+	Name         string
+	Measurements []Measurement
+	// MaxConnections overrides ChartOptions.MaxConnections for this
+	// facet, as every server has its own limit.
+	MaxConnections int
+}
+
+// RenderFacetChart renders each facet as a column of subplots, side by side
+// with their rows aligned, as a PNG chart into w.
+func RenderFacetChart(w io.Writer, facets []Facet, opts ChartOptions) error {
+	columns := make([][]*plot.Plot, len(facets))
+	for i, facet := range facets {
+		facetOpts := opts
+		facetOpts.MaxConnections = facet.MaxConnections
+		column, err := chartColumn(facet.Measurements, facetOpts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", facet.Name, err)
+		}
+		for _, p := range column {
+			p.Title.Text = facet.Name + ": " + p.Title.Text
+		}
+		columns[i] = column
+	}
+
+	png := vgimg.PngCanvas{Canvas: drawColumns(columns, opts)}
+	if _, err := png.WriteTo(w); err != nil {
+		return fmt.Errorf("error writing PNG: %v", err)
+	}
+	return nil
+}
+
+// RenderFacetChartContext is like RenderChartContext, for a faceted chart.
+func RenderFacetChartContext(ctx context.Context, w io.Writer, facets []Facet, opts ChartOptions) error {
+	return renderContext(ctx, w, func(w io.Writer) error {
+		return RenderFacetChart(w, facets, opts)
+	})
+}
+
+// WriteFacetChart is like WriteChart, for a faceted chart.
+func WriteFacetChart(filename string, facets []Facet, opts ChartOptions) error {
+	return WriteFacetChartContext(context.Background(), filename, facets, opts)
+}
+
+// WriteFacetChartContext is like WriteChartContext, for a faceted chart.
+func WriteFacetChartContext(ctx context.Context, filename string, facets []Facet, opts ChartOptions) error {
+	return writeAtomically(filename, func(w io.Writer) error {
+		return RenderFacetChartContext(ctx, w, facets, opts)
+	})
+}
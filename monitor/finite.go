@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"math"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+// finiteRuns splits pts at the points with a NaN or infinite coordinate,
+// e.g. a ratio over zero, which gonum refuses to plot. It returns the runs
+// of finite points in between, so that such points leave a gap in the line,
+// and how many points were dropped.
+func finiteRuns(pts plotter.XYs) (runs []plotter.XYs, dropped int) {
+	from := 0
+	for i, pt := range pts {
+		if isFinite(pt.X) && isFinite(pt.Y) {
+			continue
+		}
+		if i > from {
+			runs = append(runs, pts[from:i])
+		}
+		from = i + 1
+		dropped++
+	}
+	if from < len(pts) {
+		runs = append(runs, pts[from:])
+	}
+	return runs, dropped
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+func TestFiniteRuns(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	tests := []struct {
+		name    string
+		pts     plotter.XYs
+		runs    []int
+		dropped int
+	}{
+		{"empty", nil, nil, 0},
+		{"all finite", plotter.XYs{{X: 0, Y: 1}, {X: 1, Y: 2}}, []int{2}, 0},
+		{"gap", plotter.XYs{{X: 0, Y: 1}, {X: 1, Y: nan}, {X: 2, Y: 2}, {X: 3, Y: 3}}, []int{1, 2}, 1},
+		{"infinite", plotter.XYs{{X: 0, Y: 1}, {X: 1, Y: inf}, {X: 2, Y: -inf}, {X: 3, Y: 3}}, []int{1, 1}, 2},
+		{"infinite X", plotter.XYs{{X: inf, Y: 1}, {X: 1, Y: 2}}, []int{1}, 1},
+		{"leading and trailing", plotter.XYs{{X: 0, Y: nan}, {X: 1, Y: 1}, {X: 2, Y: nan}}, []int{1}, 2},
+		{"all NaN", plotter.XYs{{X: 0, Y: nan}, {X: 1, Y: nan}}, nil, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, dropped := finiteRuns(tt.pts)
+			var lengths []int
+			for _, run := range runs {
+				lengths = append(lengths, len(run))
+				for _, pt := range run {
+					if !isFinite(pt.X) || !isFinite(pt.Y) {
+						t.Errorf("run has the point %v", pt)
+					}
+				}
+			}
+			if !slices.Equal(lengths, tt.runs) {
+				t.Errorf("runs of %v points, want %v", lengths, tt.runs)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.dropped)
+			}
+		})
+	}
+}
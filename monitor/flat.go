@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"maps"
+	"time"
+)
+
+// flat reports whether b has the same values as a, the measurement before
+// it, for Recorder.CollapseFlat. The duration and round trip of the
+// monitor's own query are not compared, as they differ on every sample, so
+// collapsing is lossy: the durations within a run are dropped, spikes
+// included, and only those at its ends are kept. Neither is Uptime
+// compared, only the server start time it implies, as it grows on every
+// sample.
+func flat(a, b Measurement) bool {
+	if a.Uptime != 0 || b.Uptime != 0 {
+		// Uptime has a resolution of a second
+		started := a.Timestamp.Add(-a.Uptime).Sub(b.Timestamp.Add(-b.Uptime))
+		if started < -2*time.Second || started > 2*time.Second {
+			return false
+		}
+	}
+	return a.Failed == b.Failed &&
+		a.Paused == b.Paused &&
+		a.Backfilled == b.Backfilled &&
+		a.Connections == b.Connections &&
+		a.ActiveQueries == b.ActiveQueries &&
+		a.DistinctClients == b.DistinctClients &&
+		a.QueryP50 == b.QueryP50 &&
+		a.QueryP99 == b.QueryP99 &&
+		a.TableRows == b.TableRows &&
+		a.TableRowsFailed == b.TableRowsFailed &&
+		a.ActiveQueriesFailed == b.ActiveQueriesFailed &&
+		a.DistinctClientsFailed == b.DistinctClientsFailed &&
+		a.DashboardValueFailed == b.DashboardValueFailed &&
+		a.KeeperFailed == b.KeeperFailed &&
+		a.QueryQueueFailed == b.QueryQueueFailed &&
+		a.DistributedFailed == b.DistributedFailed &&
+		a.DashboardValue == b.DashboardValue &&
+		a.ConnectionsAvg == b.ConnectionsAvg &&
+		a.KeeperSessions == b.KeeperSessions &&
+		a.KeeperRequests == b.KeeperRequests &&
+		a.QueriesRunning == b.QueriesRunning &&
+		a.QueriesWaiting == b.QueriesWaiting &&
+		a.DistributedSends == b.DistributedSends &&
+		a.DistributedFilesToInsert == b.DistributedFilesToInsert &&
+		maps.Equal(a.ProfileEvents, b.ProfileEvents) &&
+		maps.Equal(a.Metrics, b.Metrics)
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlat(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := Measurement{Timestamp: start, Connections: 3, QueryDuration: time.Millisecond, ProfileEvents: map[string]uint64{"SelectQuery": 1}}
+	with := func(change func(*Measurement)) Measurement {
+		b := a
+		b.Timestamp = start.Add(time.Second)
+		b.ProfileEvents = map[string]uint64{"SelectQuery": 1}
+		change(&b)
+		return b
+	}
+	tests := []struct {
+		name string
+		b    Measurement
+		want bool
+	}{
+		{"same values", with(func(m *Measurement) {}), true},
+		{"other query duration", with(func(m *Measurement) { m.QueryDuration = time.Second }), true},
+		{"other connections", with(func(m *Measurement) { m.Connections = 4 }), false},
+		{"failed", with(func(m *Measurement) { m.Failed = true }), false},
+		{"optional query failed", with(func(m *Measurement) { m.DistinctClientsFailed = true }), false},
+		{"backfilled", with(func(m *Measurement) { m.Backfilled = true }), false},
+		{"counter moved", with(func(m *Measurement) { m.ProfileEvents["SelectQuery"] = 2 }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flat(a, tt.b); got != tt.want {
+				t.Errorf("flat = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Uptime grows with the samples as long as the server does not restart
+	up := a
+	up.Uptime = time.Hour
+	later := up
+	later.Timestamp, later.Uptime = start.Add(time.Minute), time.Hour+time.Minute
+	if !flat(up, later) {
+		t.Errorf("flat = false across samples of the same server start")
+	}
+	later.Uptime = time.Second
+	if flat(up, later) {
+		t.Errorf("flat = true across a restart")
+	}
+}
+
+func TestRecorderCollapseFlat(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		connections []int
+		want        []int
+	}{
+		{"empty", nil, nil},
+		{"no runs", []int{1, 2, 3}, []int{1, 2, 3}},
+		{"run", []int{1, 1, 1, 1, 2}, []int{1, 1, 2}},
+		{"two runs", []int{5, 5, 5, 7, 7, 7, 7}, []int{5, 5, 7, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Recorder{CollapseFlat: true}
+			for i, c := range tt.connections {
+				r.Write(Measurement{Timestamp: start.Add(time.Duration(i) * time.Second), Connections: c})
+			}
+			got := r.Measurements()
+			if len(got) != len(tt.want) {
+				t.Fatalf("kept %d measurements, want %d", len(got), len(tt.want))
+			}
+			for i, m := range got {
+				if m.Connections != tt.want[i] {
+					t.Errorf("measurement %d has %d connections, want %d", i, m.Connections, tt.want[i])
+				}
+			}
+			// The run keeps its last measurement
+			if n := len(got); n > 0 && !got[n-1].Timestamp.Equal(start.Add(time.Duration(len(tt.connections)-1)*time.Second)) {
+				t.Errorf("last measurement at %s, want the last written", got[n-1].Timestamp)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// health counts the collector's own activity. Its fields are updated by the
+// collector goroutine and read concurrently by Health.
+type health struct {
+	samples       atomic.Uint64
+	failedSamples atomic.Uint64
+	pausedSamples atomic.Uint64
+	recoveries    atomic.Uint64
+	bufferFull    atomic.Uint64
+	collections   atomic.Uint64
+	collectNanos  atomic.Int64
+	// failing is whether the last collection failed, only used by the
+	// collector goroutine.
+	failing bool
+}
+
+// record accounts for a batch collected in elapsed.
+func (h *health) record(batch []Measurement, elapsed time.Duration) {
+	h.collections.Add(1)
+	h.collectNanos.Add(int64(elapsed))
+	failed := len(batch) == 1 && batch[0].Failed
+	if failed {
+		h.failedSamples.Add(1)
+	} else if h.failing {
+		h.recoveries.Add(1)
+	}
+	h.failing = failed
+	h.samples.Add(uint64(len(batch)))
+}
+
+// recordPause accounts for a paused measurement of the circuit breaker,
+// which is counted apart from the failed ones.
+func (h *health) recordPause() {
+	h.pausedSamples.Add(1)
+	h.samples.Add(1)
+}
+
+// Health is a snapshot of the collector's own health, as opposed to the
+// server metrics it collects, to tell why a chart has gaps.
+type Health struct {
+	// Samples is the number of measurements published, including failed
+	// and paused ones.
+	Samples uint64 `json:"samples"`
+	// FailedSamples is the number of collections whose query failed,
+	// leaving a gap in the chart.
+	FailedSamples uint64 `json:"failed_samples"`
+	// PausedSamples is the number of paused measurements published by the
+	// circuit breaker, two per pause, see Measurement.Paused. They are not
+	// counted in FailedSamples.
+	PausedSamples uint64 `json:"paused_samples"`
+	// Reconnects is the number of times collection succeeded again after a
+	// failure, e.g. once the connection to the server was re-established.
+	Reconnects uint64 `json:"reconnects"`
+	// BufferFull is the number of times a measurement found the buffer full
+	// and collection stalled until a sink caught up. Measurements are never
+	// dropped, but stalls delay the following samples.
+	BufferFull uint64 `json:"buffer_full"`
+	// BufferDepth is the number of measurements currently buffered, out of
+	// BufferSize.
+	BufferDepth int `json:"buffer_depth"`
+	BufferSize  int `json:"buffer_size"`
+	// CollectLatencyAvg is the average time taken by a collection, i.e. all
+	// of the queries of one sample.
+	CollectLatencyAvg time.Duration `json:"collect_latency_avg_ns"`
+	// OpenConns is the number of connections open in the client pool.
+	OpenConns int `json:"open_conns"`
+}
+
+// Health returns a snapshot of the collector's own health. It is safe to
+// call while collecting.
+func (m *Monitor) Health() Health {
+	h := Health{
+		Samples:       m.health.samples.Load(),
+		FailedSamples: m.health.failedSamples.Load(),
+		PausedSamples: m.health.pausedSamples.Load(),
+		Reconnects:    m.health.recoveries.Load(),
+		BufferFull:    m.health.bufferFull.Load(),
+		BufferDepth:   len(m.measurements),
+		BufferSize:    cap(m.measurements),
+	}
+	// Only a ClickHouseSource has a client pool
+	if m.clickhouse != nil {
+		h.OpenConns = m.clickhouse.conn.Stats().Open
+	}
+	if collections := m.health.collections.Load(); collections > 0 {
+		h.CollectLatencyAvg = time.Duration(m.health.collectNanos.Load() / int64(collections))
+	}
+	return h
+}
+
+// WriteHealthMetrics writes h in the Prometheus text exposition format,
+// labelled with tags.
+func WriteHealthMetrics(w io.Writer, h Health, tags map[string]string) error {
+	bw := bufio.NewWriter(w)
+	labels := formatLabels(tags, "", "")
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(bw, "%s%s %g\n", name, labels, value)
+	}
+	metric("clickhouse_monitor_self_samples_total", "counter", "Measurements published, including failed and paused ones.", float64(h.Samples))
+	metric("clickhouse_monitor_self_failed_samples_total", "counter", "Collections whose query failed.", float64(h.FailedSamples))
+	metric("clickhouse_monitor_self_paused_samples_total", "counter", "Paused measurements published by the circuit breaker, two per pause.", float64(h.PausedSamples))
+	metric("clickhouse_monitor_self_reconnects_total", "counter", "Successful collections after a failed one.", float64(h.Reconnects))
+	metric("clickhouse_monitor_self_buffer_full_total", "counter", "Times collection stalled on a full measurement buffer.", float64(h.BufferFull))
+	metric("clickhouse_monitor_self_buffer_depth", "gauge", "Measurements currently buffered.", float64(h.BufferDepth))
+	metric("clickhouse_monitor_self_buffer_size", "gauge", "Capacity of the measurement buffer.", float64(h.BufferSize))
+	metric("clickhouse_monitor_self_collect_latency_avg_seconds", "gauge", "Average duration of a collection.", h.CollectLatencyAvg.Seconds())
+	metric("clickhouse_monitor_self_open_conns", "gauge", "Connections open in the client pool.", float64(h.OpenConns))
+	return bw.Flush()
+}
+
+// HealthHandler returns an HTTP handler serving Health in the Prometheus
+// text exposition format, labelled with tags, for scraping as /metrics.
+func (m *Monitor) HealthHandler(tags map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		// Errors only mean the scraper went away
+		_ = WriteHealthMetrics(w, m.Health(), tags)
+	})
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	m := &Monitor{measurements: make(chan Measurement, 4)}
+	ok := []Measurement{{Connections: 1}}
+	failed := []Measurement{{Failed: true}}
+	for _, batch := range [][]Measurement{ok, failed, failed, ok, ok} {
+		m.health.record(batch, time.Millisecond)
+	}
+	// A pause of the circuit breaker
+	m.health.recordPause()
+	m.health.recordPause()
+
+	h := m.Health()
+	want := Health{Samples: 7, FailedSamples: 2, PausedSamples: 2, Reconnects: 1, BufferSize: 4, CollectLatencyAvg: time.Millisecond}
+	if h != want {
+		t.Errorf("Health() = %+v, want %+v", h, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHealthMetrics(&buf, h, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"clickhouse_monitor_self_samples_total 7\n",
+		"clickhouse_monitor_self_failed_samples_total 2\n",
+		"clickhouse_monitor_self_paused_samples_total 2\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("WriteHealthMetrics has no %q", line)
+		}
+	}
+}
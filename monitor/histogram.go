@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// DefaultLatencyBuckets are the bucket edges of the latency histogram when
+// ChartOptions.LatencyBuckets is empty.
+var DefaultLatencyBuckets = []time.Duration{time.Millisecond, 5 * time.Millisecond, 50 * time.Millisecond}
+
+// latencyHistogram returns a bar chart of how many samples' query durations
+// fall in each of the buckets delimited by edges, which must be ascending.
+// Failed samples, and backfilled ones, which have no query duration, are not
+// counted.
+func latencyHistogram(measurements []Measurement, edges []time.Duration, palette *Palette) (*plot.Plot, error) {
+	counts := make(plotter.Values, len(edges)+1)
+	for _, m := range measurements {
+		if m.Failed || m.Backfilled {
+			continue
+		}
+		bucket := len(edges)
+		for i, edge := range edges {
+			if m.QueryDuration < edge {
+				bucket = i
+				break
+			}
+		}
+		counts[bucket]++
+	}
+
+	labels := make([]string, len(counts))
+	labels[0] = fmt.Sprintf("<%s", edges[0])
+	for i := 1; i < len(edges); i++ {
+		labels[i] = fmt.Sprintf("%s–%s", edges[i-1], edges[i])
+	}
+	labels[len(edges)] = fmt.Sprintf("≥%s", edges[len(edges)-1])
+
+	p := plot.New()
+	p.Title.Text = "Query Duration Distribution"
+	p.Y.Label.Text = "Number of Samples"
+	p.X.Label.Text = "Query Duration"
+	bars, err := plotter.NewBarChart(counts, vg.Points(120))
+	if err != nil {
+		return nil, err
+	}
+	if palette != nil {
+		bars.Color = palette.series(0)
+		bars.LineStyle.Color = palette.series(0)
+	}
+	p.Add(bars)
+	p.NominalX(labels...)
+	p.X.Min, p.X.Max = -0.5, float64(len(labels))-0.5
+	return p, nil
+}
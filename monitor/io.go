@@ -0,0 +1,16 @@
+package monitor
+
+// IOEvents are the system.events byte counters that ChartOptions.IOThroughput
+// plots, to be collected with Options.ProfileEvents.
+var IOEvents = []string{"ReadBufferFromFileDescriptorReadBytes", "WriteBufferFromFileDescriptorWriteBytes", "NetworkReceiveBytes", "NetworkSendBytes"}
+
+// profileEvent returns the value of the counter event in a sample, and
+// false for samples without counters, e.g. failed ones.
+func profileEvent(event string) func(Measurement) (float64, bool) {
+	return func(m Measurement) (float64, bool) {
+		if m.ProfileEvents == nil {
+			return 0, false
+		}
+		return float64(m.ProfileEvents[event]), true
+	}
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"unicode"
+)
+
+// taggedMeasurement is a Measurement as streamed to consumers, with the tags
+// identifying the monitor instance.
+type taggedMeasurement struct {
+	Measurement
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// JSONLinesSink is a Sink that writes each measurement as a JSON object on
+// its own line, as soon as it is collected, for jq and log shippers.
+type JSONLinesSink struct {
+	tags map[string]string
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewJSONLinesSink returns a JSONLinesSink writing to w, with tags on every
+// line.
+func NewJSONLinesSink(w io.Writer, tags map[string]string) *JSONLinesSink {
+	return &JSONLinesSink{tags: tags, enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLinesSink) Write(m Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(taggedMeasurement{Measurement: m, Tags: s.tags})
+}
+
+// jsonRequired are the fields ReadJSON requires of every measurement, those
+// that are always written.
+var jsonRequired = []string{"timestamp", "connections", "query_duration_ns"}
+
+// ReadJSON reads measurements written by JSONLinesSink, one object per line,
+// or a JSON array of them like the web UI's /measurements. Tags are
+// ignored.
+func ReadJSON(r io.Reader) ([]Measurement, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty JSON")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if first == '[' {
+		var raw []json.RawMessage
+		if err := json.NewDecoder(br).Decode(&raw); err != nil {
+			return nil, err
+		}
+		measurements := make([]Measurement, len(raw))
+		for i, object := range raw {
+			if measurements[i], err = decodeMeasurement(object); err != nil {
+				return nil, fmt.Errorf("element %d: %w", i+1, err)
+			}
+		}
+		return measurements, nil
+	}
+
+	var measurements []Measurement
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		m, err := decodeMeasurement(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		measurements = append(measurements, m)
+	}
+	return measurements, scanner.Err()
+}
+
+// decodeMeasurement decodes a JSON object as a Measurement, checking the
+// fields in jsonRequired.
+func decodeMeasurement(object []byte) (Measurement, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return Measurement{}, err
+	}
+	for _, name := range jsonRequired {
+		if _, ok := fields[name]; !ok {
+			return Measurement{}, fmt.Errorf("missing field %s", name)
+		}
+	}
+	var m Measurement
+	if err := json.Unmarshal(object, &m); err != nil {
+		return Measurement{}, err
+	}
+	return m, nil
+}
+
+// peekNonSpace skips leading whitespace in r and returns the next byte
+// without consuming it.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadJSON(t *testing.T) {
+	const line = `{"timestamp":"2024-01-01T00:00:01Z","connections":3,"query_duration_ns":1000}`
+	tests := []struct {
+		name  string
+		in    string
+		count int
+		ok    bool
+	}{
+		{"empty", "", 0, false},
+		{"whitespace", " \n\t", 0, false},
+		{"lines", line + "\n" + line + "\n", 2, true},
+		{"blank lines", "\n" + line + "\n\n" + line, 2, true},
+		{"array", "[" + line + "," + line + "]", 2, true},
+		{"empty array", " []", 0, true},
+		{"truncated line", line + "\n" + line[:20], 0, false},
+		{"truncated array", "[" + line + "," + line[:20], 0, false},
+		{"missing field", `{"timestamp":"2024-01-01T00:00:01Z","connections":3}`, 0, false},
+		{"missing field in array", `[` + line + `,{"connections":3,"query_duration_ns":1000}]`, 0, false},
+		{"not an object", "3\n", 0, false},
+		{"wrong type", `{"timestamp":"2024-01-01T00:00:01Z","connections":"3","query_duration_ns":1000}`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadJSON(strings.NewReader(tt.in))
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("ReadJSON = %d measurements, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadJSON: %v", err)
+			}
+			if len(got) != tt.count {
+				t.Errorf("ReadJSON = %d measurements, want %d", len(got), tt.count)
+			}
+		})
+	}
+}
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []Measurement{
+		{Timestamp: start, Connections: 3, QueryDuration: time.Millisecond, ProfileEvents: map[string]uint64{"SelectQuery": 7}},
+		{Timestamp: start.Add(time.Second), Failed: true, Paused: true},
+		{Timestamp: start.Add(2 * time.Second), Connections: 4, KeeperFailed: true, Backfilled: true},
+	}
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf, map[string]string{"env": "test"})
+	for _, m := range want {
+		if err := sink.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d measurements, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || !flat(got[i], want[i]) || got[i].QueryDuration != want[i].QueryDuration {
+			t.Errorf("measurement %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+)
+
+// Capture is a named run of measurements, e.g. one CSV file, for Merge.
+type Capture struct {
+	Name         string
+	Measurements []Measurement
+}
+
+// Merge stitches captures onto one timeline by their absolute timestamps,
+// e.g. consecutive captures of the same server, and returns the
+// measurements with an Event labelled with the name of each capture where
+// it starts. Where a capture overlaps the ones before it, its measurements
+// up to their end are dropped, and their count returned, so that the lines
+// do not zigzag between them. Between captures that do not touch, a pair of
+// paused measurements, see Measurement.Paused, leaves a gap rather than a
+// line across the time nothing was captured.
+func Merge(captures []Capture) ([]Measurement, []Event, int) {
+	var sorted []Capture
+	for _, c := range captures {
+		if len(c.Measurements) == 0 {
+			continue
+		}
+		ms := append([]Measurement(nil), c.Measurements...)
+		sort.SliceStable(ms, func(a, b int) bool { return ms[a].Timestamp.Before(ms[b].Timestamp) })
+		sorted = append(sorted, Capture{Name: c.Name, Measurements: ms})
+	}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Measurements[0].Timestamp.Before(sorted[b].Measurements[0].Timestamp)
+	})
+
+	var (
+		merged  []Measurement
+		events  []Event
+		dropped int
+		end     time.Time
+	)
+	for _, c := range sorted {
+		kept := c.Measurements
+		for len(kept) > 0 && len(merged) > 0 && !kept[0].Timestamp.After(end) {
+			kept = kept[1:]
+			dropped++
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		if len(merged) > 0 && len(kept) == len(c.Measurements) {
+			merged = append(merged,
+				Measurement{Timestamp: end, Failed: true, Paused: true},
+				Measurement{Timestamp: kept[0].Timestamp, Failed: true, Paused: true})
+		}
+		events = append(events, Event{Time: kept[0].Timestamp, Label: c.Name})
+		for _, m := range kept {
+			// Elapsed is relative to the start of each capture's monitor
+			m.Elapsed = 0
+			merged = append(merged, m)
+		}
+		end = kept[len(kept)-1].Timestamp
+	}
+	return merged, events, dropped
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	capture := func(name string, seconds ...int) Capture {
+		c := Capture{Name: name}
+		for _, s := range seconds {
+			c.Measurements = append(c.Measurements, Measurement{Timestamp: start.Add(time.Duration(s) * time.Second), Connections: s, Elapsed: time.Second})
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		captures []Capture
+		// want is the seconds of the merged measurements, with -1 for a
+		// paused one
+		want    []int
+		events  []string
+		dropped int
+	}{
+		{"empty", nil, nil, nil, 0},
+		{"empty capture", []Capture{capture("a"), capture("b", 1, 2)}, []int{1, 2}, []string{"b"}, 0},
+		{"consecutive", []Capture{capture("a", 1, 2), capture("b", 3, 4)}, []int{1, 2, -1, -1, 3, 4}, []string{"a", "b"}, 0},
+		{"out of order", []Capture{capture("b", 4, 3), capture("a", 2, 1)}, []int{1, 2, -1, -1, 3, 4}, []string{"a", "b"}, 0},
+		{"overlapping", []Capture{capture("a", 1, 2, 3), capture("b", 2, 3, 4, 5)}, []int{1, 2, 3, 4, 5}, []string{"a", "b"}, 2},
+		{"contained", []Capture{capture("a", 1, 5), capture("b", 2, 3)}, []int{1, 5}, []string{"a"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, events, dropped := Merge(tt.captures)
+			var got []int
+			for _, m := range merged {
+				if m.Elapsed != 0 {
+					t.Errorf("Elapsed = %s, want it cleared", m.Elapsed)
+				}
+				if m.Paused {
+					got = append(got, -1)
+				} else {
+					got = append(got, m.Connections)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("merged = %v, want %v", got, tt.want)
+			}
+			var labels []string
+			for _, e := range events {
+				labels = append(labels, e.Label)
+			}
+			if !slices.Equal(labels, tt.events) {
+				t.Errorf("events = %v, want %v", labels, tt.events)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.dropped)
+			}
+		})
+	}
+}
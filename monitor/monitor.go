@@ -0,0 +1,749 @@
+// Package monitor samples ClickHouse connection metrics and renders them as
+// charts. It is the engine behind the clickhouse-monitor CLI, exposed so the
+// collector can be embedded in other tools.
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// DefaultInterval is the pause between samples when Options.Interval is zero.
+const DefaultInterval = 300 * time.Millisecond
+
+// DefaultMaxInterval is the upper bound of the adaptive interval when
+// Options.MaxInterval is zero.
+const DefaultMaxInterval = 10 * time.Second
+
+// DefaultQueryLogWindow is the window latency percentiles are computed over
+// when Options.QueryLogWindow is zero. It is longer than the default
+// query_log flush interval of 7.5s so that windows are rarely empty.
+const DefaultQueryLogWindow = 10 * time.Second
+
+// DefaultSystemDB is the database queried for server metrics when
+// Options.SystemDB is empty.
+const DefaultSystemDB = "system"
+
+// DefaultBufferSize is the measurements channel capacity when
+// Options.BufferSize is zero.
+const DefaultBufferSize = 100
+
+// latencyCheckSamples is the number of successful collections whose median
+// latency is compared with the interval, see Monitor.checkLatency.
+const latencyCheckSamples = 5
+
+// ConnectionSource is what Measurement.Connections counts.
+type ConnectionSource string
+
+const (
+	// ConnectionsMetrics counts the open TCP and HTTP client sockets, from
+	// the TCPConnection and HTTPConnection metrics in system.metrics. An
+	// idle pooled connection counts, a query over HTTP keep-alive counts
+	// once however many it runs.
+	ConnectionsMetrics ConnectionSource = "metrics"
+	// ConnectionsProcesses counts the queries executing, as count() of
+	// system.processes. Idle connections do not count, and the monitor's
+	// own query always does.
+	ConnectionsProcesses ConnectionSource = "processes"
+	// ConnectionsBoth counts sockets like ConnectionsMetrics and also
+	// collects Measurement.ActiveQueries like ConnectionsProcesses, to plot
+	// them together.
+	ConnectionsBoth ConnectionSource = "both"
+)
+
+// DefaultConnectionSource is the ConnectionSource when
+// Options.ConnectionSource is empty.
+const DefaultConnectionSource = ConnectionsMetrics
+
+// Measurement is a single sample. Durations are encoded in JSON as
+// nanoseconds.
+type Measurement struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Elapsed is the time since the Monitor was created, on the monotonic
+	// clock, so that the time axis is not distorted when the wall clock of
+	// Timestamp jumps, e.g. on NTP adjustments. It is zero for measurements
+	// the server recorded, e.g. backfilled ones.
+	Elapsed       time.Duration `json:"elapsed_ns,omitempty"`
+	Connections   int           `json:"connections"`
+	QueryDuration time.Duration `json:"query_duration_ns"`
+	// Failed is whether the sample's query failed, e.g. because the server
+	// was unreachable, leaving every other value unset.
+	Failed bool `json:"failed,omitempty"`
+	// Paused marks the start and the end of a pause of collection by the
+	// circuit breaker, see Options.BreakerLatency. Failed is also set, and
+	// every other value is unset.
+	Paused bool `json:"paused,omitempty"`
+	// Backfilled is whether the sample was read from system.metric_log by
+	// Backfill rather than collected, in which case it has no
+	// QueryDuration, RoundTrip, QueryP50, QueryP99 or Uptime.
+	Backfilled bool `json:"backfilled,omitempty"`
+	// RoundTrip is how long the sample's query took, until it failed if
+	// Failed, to tell a slow server from an unreachable one.
+	RoundTrip time.Duration `json:"round_trip_ns"`
+	// ActiveQueries is the count() of system.processes, only collected
+	// with ConnectionsBoth, as Connections then counts sockets.
+	ActiveQueries int `json:"active_queries,omitempty"`
+	// ActiveQueriesFailed, and the other ...Failed fields, record that the
+	// values before them are missing, leaving them zero while the rest of
+	// the sample succeeded: their query failed, or Backfill cannot read
+	// them.
+	ActiveQueriesFailed bool `json:"active_queries_failed,omitempty"`
+	// DistinctClients is the number of distinct client hosts with a running
+	// query, only collected with Options.CountDistinctClients.
+	DistinctClients       int  `json:"distinct_clients,omitempty"`
+	DistinctClientsFailed bool `json:"distinct_clients_failed,omitempty"`
+	// QueryP50 and QueryP99 are percentiles of the duration of user queries
+	// finished within Options.QueryLogWindow, only collected with
+	// Options.QueryLogLatency.
+	QueryP50 time.Duration `json:"query_p50_ns,omitempty"`
+	QueryP99 time.Duration `json:"query_p99_ns,omitempty"`
+	// TableRows is the row count of Options.WatchTable, or the value of
+	// Options.WatchExpr, rounded and with negative values as zero.
+	TableRows       uint64 `json:"table_rows,omitempty"`
+	TableRowsFailed bool   `json:"table_rows_failed,omitempty"`
+	// DashboardValue is the latest value of Options.DashboardQuery.
+	DashboardValue       float64 `json:"dashboard_value,omitempty"`
+	DashboardValueFailed bool    `json:"dashboard_value_failed,omitempty"`
+	// ProfileEvents holds the value of each counter in
+	// Options.ProfileEvents, keyed by name.
+	ProfileEvents map[string]uint64 `json:"profile_events,omitempty"`
+	// Metrics holds the values of a MetricSource, or of Options.Series,
+	// keyed by name, see NewWithSource.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// ConnectionsAvg is the average over the second of Timestamp with
+	// Options.ServerAggregate, where Connections holds the maximum.
+	ConnectionsAvg float64 `json:"connections_avg,omitempty"`
+	// KeeperSessions and KeeperRequests are the open ZooKeeper/Keeper
+	// sessions and in-flight requests, only collected with Options.Keeper.
+	KeeperSessions int  `json:"keeper_sessions,omitempty"`
+	KeeperRequests int  `json:"keeper_requests,omitempty"`
+	KeeperFailed   bool `json:"keeper_failed,omitempty"`
+	// QueriesRunning and QueriesWaiting are the queries executing and the
+	// queries paused in favour of higher-priority ones, only collected with
+	// Options.QueryQueue.
+	QueriesRunning   int  `json:"queries_running,omitempty"`
+	QueriesWaiting   int  `json:"queries_waiting,omitempty"`
+	QueryQueueFailed bool `json:"query_queue_failed,omitempty"`
+	// DistributedSends and DistributedFilesToInsert are the connections
+	// sending data of Distributed tables to their shards and the files
+	// queued for sending, the insert backlog, only collected with
+	// Options.Distributed.
+	DistributedSends         int  `json:"distributed_sends,omitempty"`
+	DistributedFilesToInsert int  `json:"distributed_files_to_insert,omitempty"`
+	DistributedFailed        bool `json:"distributed_failed,omitempty"`
+	// Uptime is the server's uptime, with a resolution of a second, only
+	// collected with Options.Uptime.
+	Uptime time.Duration `json:"uptime_ns,omitempty"`
+}
+
+type Options struct {
+	// Interval is the pause between samples. Defaults to DefaultInterval.
+	Interval time.Duration
+	// AdaptiveInterval scales the pause between samples with the measured
+	// query latency relative to the fastest latency seen so far, within
+	// [MinInterval, MaxInterval], so that the monitor backs off while the
+	// server is busy. Sample spacing then varies.
+	AdaptiveInterval bool
+	// MinInterval and MaxInterval bound the adaptive interval. They default
+	// to Interval and DefaultMaxInterval.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// ConnectionSource is what Measurement.Connections counts. Defaults to
+	// DefaultConnectionSource.
+	ConnectionSource ConnectionSource
+	// CountDistinctClients also collects Measurement.DistinctClients.
+	CountDistinctClients bool
+	// QueryLogLatency collects Measurement.QueryP50 and QueryP99 from
+	// system.query_log, reflecting real user queries rather than the
+	// monitor's own.
+	QueryLogLatency bool
+	// QueryLogWindow is how far back QueryLogLatency looks on each sample.
+	// Defaults to DefaultQueryLogWindow.
+	QueryLogWindow time.Duration
+	// QueryLogExclude leaves queries out of QueryLogLatency, besides the
+	// monitor's own when RunID is set.
+	QueryLogExclude QueryLogExclusion
+	// WatchTable, as db.table, collects its row count into
+	// Measurement.TableRows on every sample.
+	WatchTable string
+	// WatchExpr, if set, is the aggregate collected instead of count(),
+	// e.g. sum(sign) for a CollapsingMergeTree. See ValidateWatchExpr.
+	WatchExpr string
+	// WatchFinal reads WatchTable with FINAL, merging the rows that
+	// Replacing and Collapsing engines have not merged yet, at the cost of
+	// doing that merge on every sample.
+	WatchFinal bool
+	// ProfileEvents are system.events counters collected into
+	// Measurement.ProfileEvents.
+	ProfileEvents []string
+	// DashboardQuery is a system.dashboards panel query, see
+	// DashboardQuery, whose latest value is collected into
+	// Measurement.DashboardValue.
+	DashboardQuery string
+	// Series are queries returning a single number, each collected into
+	// Measurement.Metrics under its name. See CheckSeries.
+	Series []Series
+	// BufferSize is the capacity of the measurements channel. Defaults to
+	// DefaultBufferSize.
+	BufferSize int
+	// ServerAggregate replaces sampling with one query per Interval that
+	// reads per-second max and average connections from system.metric_log
+	// since the previous query, see Measurement.ConnectionsAvg. Only
+	// connections and the query duration are collected; use an Interval of
+	// several seconds, as the server flushes metric_log periodically.
+	ServerAggregate bool
+	// ClockOffset is how far the server's clock is ahead of the monitor's,
+	// see ClockOffset. The timestamps the server reports for
+	// ServerAggregate are shifted back by it onto the monitor's clock, so
+	// that the series of servers with different clocks line up.
+	ClockOffset time.Duration
+	// Keeper also collects Measurement.KeeperSessions and KeeperRequests,
+	// see CheckKeeper.
+	Keeper bool
+	// QueryQueue also collects Measurement.QueriesRunning and
+	// QueriesWaiting, from the Query and QueryPreempted metrics.
+	QueryQueue bool
+	// Distributed also collects Measurement.DistributedSends and
+	// DistributedFilesToInsert, see CheckDistributed.
+	Distributed bool
+	// Uptime also collects Measurement.Uptime, to detect server restarts.
+	Uptime bool
+	// Remote, if set, is the server observed, through the remote() table
+	// function of the connected one. The connected server only relays.
+	Remote *Remote
+	// SystemDB is the database holding the system tables, for deployments
+	// where it is aliased or proxied. Defaults to DefaultSystemDB.
+	SystemDB string
+	// DebugDump, if set, receives every query of one in DebugDumpEvery
+	// samples, with the values scanned, as JSON lines of DumpRecord, to
+	// see what the monitor actually queried and received. The password of
+	// Remote is redacted.
+	DebugDump io.Writer
+	// DebugDumpEvery is the sampling of DebugDump. Defaults to
+	// DefaultDebugDumpEvery.
+	DebugDumpEvery int
+	// BreakerLatency, if set, pauses collection for BreakerCooldown once
+	// BreakerSamples consecutive collections took longer, so as not to
+	// load a server in distress further. After the pause, a single slow
+	// collection pauses it again.
+	BreakerLatency time.Duration
+	// BreakerSamples defaults to DefaultBreakerSamples and BreakerCooldown
+	// to DefaultBreakerCooldown.
+	BreakerSamples  int
+	BreakerCooldown time.Duration
+	// OnError, if set, is called with every query error once it is logged,
+	// with what the query collects as in Step.Name, e.g. to stop at the
+	// first one. Verify returns the errors instead.
+	OnError func(name string, err error)
+	// RunID, if set, prefixes the query_id of every query the monitor
+	// runs, as RunID-N, so that its own queries can be found or excluded
+	// in system.query_log.
+	RunID string
+}
+
+// Monitor periodically collects a Measurement from a MetricSource, usually a
+// ClickHouseSource, and publishes it on its measurements channel.
+type Monitor struct {
+	opts         Options
+	measurements chan Measurement
+	// fastest is the lowest query latency seen, the reference for the
+	// adaptive interval.
+	fastest time.Duration
+	// aggregatedUntil is where the next ServerAggregate query resumes.
+	aggregatedUntil time.Time
+	health          health
+	// latencies are the first collection latencies, until checkLatency
+	// has enough of them.
+	latencies      []time.Duration
+	latencyChecked bool
+	// created is the reference of Measurement.Elapsed.
+	created time.Time
+	// source is the MetricSource sampled, see NewWithSource.
+	source MetricSource
+	// clickhouse is source if it is a ClickHouseSource, which the Monitor
+	// also queries for Options.ServerAggregate.
+	clickhouse *ClickHouseSource
+	// dump records the queries of sampled ticks, see Options.DebugDump.
+	dump    *dumper
+	breaker breaker
+}
+
+// New returns a Monitor of the server of conn, sampling it with a
+// ClickHouseSource.
+func New(conn driver.Conn, opts Options) *Monitor {
+	m := newMonitor(opts)
+	if opts.DebugDump != nil && conn != nil {
+		m.dump = &dumper{w: opts.DebugDump, every: uint64(opts.DebugDumpEvery), remote: opts.Remote}
+		conn = &dumpConn{Conn: conn, dump: m.dump}
+	}
+	m.clickhouse = &ClickHouseSource{conn: conn, opts: m.opts}
+	m.source = m.clickhouse
+	return m
+}
+
+// newMonitor returns a Monitor without a source.
+func newMonitor(opts Options) *Monitor {
+	opts = opts.withDefaults()
+	return &Monitor{
+		opts:         opts,
+		measurements: make(chan Measurement, opts.BufferSize),
+		created:      time.Now(),
+	}
+}
+
+// withDefaults returns opts with the defaults of the options left zero.
+func (opts Options) withDefaults() Options {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = opts.Interval
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = DefaultMaxInterval
+	}
+	if opts.QueryLogWindow <= 0 {
+		opts.QueryLogWindow = DefaultQueryLogWindow
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.SystemDB == "" {
+		opts.SystemDB = DefaultSystemDB
+	}
+	if opts.ConnectionSource == "" {
+		opts.ConnectionSource = DefaultConnectionSource
+	}
+	if opts.BreakerSamples <= 0 {
+		opts.BreakerSamples = DefaultBreakerSamples
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if opts.DebugDumpEvery <= 0 {
+		opts.DebugDumpEvery = DefaultDebugDumpEvery
+	}
+	return opts
+}
+
+// Measurements returns the channel on which collected measurements are
+// published. It is closed once the collector stops.
+func (m *Monitor) Measurements() <-chan Measurement {
+	return m.measurements
+}
+
+// Start collects measurements in the background until ctx is done. It must
+// be called at most once. If the measurements channel is full, collection
+// blocks until the consumer catches up.
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		defer close(m.measurements)
+		m.aggregatedUntil = time.Now()
+		for {
+			var batch []Measurement
+			start := time.Now()
+			m.dump.tick()
+			if m.clickhouse != nil && m.opts.ServerAggregate {
+				batch = m.collectAggregated(ctx)
+			} else {
+				batch = []Measurement{m.Collect(ctx)}
+			}
+			elapsed := time.Since(start)
+			m.health.record(batch, elapsed)
+			if len(batch) > 0 && !batch[0].Failed {
+				m.checkLatency(elapsed)
+			}
+			for _, measurement := range batch {
+				if !m.publish(ctx, measurement) {
+					return
+				}
+			}
+			if !m.checkBreaker(ctx, elapsed) {
+				return
+			}
+
+			next := m.opts.Interval
+			if len(batch) > 0 {
+				next = m.nextInterval(batch[len(batch)-1])
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next):
+			}
+		}
+	}()
+}
+
+// publish sends measurement on the measurements channel, blocking while it is
+// full. It returns false if ctx is done first.
+func (m *Monitor) publish(ctx context.Context, measurement Measurement) bool {
+	select {
+	case m.measurements <- measurement:
+		return true
+	default:
+		m.health.bufferFull.Add(1)
+		log.Printf("Measurement buffer full (%d), a sink is falling behind", m.opts.BufferSize)
+		select {
+		case <-ctx.Done():
+			return false
+		case m.measurements <- measurement:
+			return true
+		}
+	}
+}
+
+// nextInterval returns the pause before the sample after measurement.
+func (m *Monitor) nextInterval(measurement Measurement) time.Duration {
+	if !m.opts.AdaptiveInterval || measurement.Failed {
+		return m.opts.Interval
+	}
+	if m.fastest == 0 || measurement.QueryDuration < m.fastest {
+		m.fastest = measurement.QueryDuration
+	}
+	slowdown := float64(measurement.QueryDuration) / float64(m.fastest)
+	interval := time.Duration(float64(m.opts.Interval) * slowdown)
+	return min(max(interval, m.opts.MinInterval), m.opts.MaxInterval)
+}
+
+// checkLatency warns once the median of the first latencyCheckSamples
+// collection latencies exceeds Options.Interval, as samples then drift
+// further apart than asked. An adaptive interval is raised to the median
+// instead, as it would only chase the latency from below.
+func (m *Monitor) checkLatency(elapsed time.Duration) {
+	if m.latencyChecked {
+		return
+	}
+	m.latencies = append(m.latencies, elapsed)
+	if len(m.latencies) < latencyCheckSamples {
+		return
+	}
+	m.latencyChecked = true
+	sort.Slice(m.latencies, func(i, j int) bool { return m.latencies[i] < m.latencies[j] })
+	median := m.latencies[len(m.latencies)/2]
+	m.latencies = nil
+	if median <= m.opts.Interval {
+		return
+	}
+	if m.opts.AdaptiveInterval {
+		m.opts.MinInterval = min(max(m.opts.MinInterval, median), m.opts.MaxInterval)
+		log.Printf("Warning: collecting takes %s, more than the %s interval, raising the adaptive interval's lower bound to %s", median.Round(time.Millisecond), m.opts.Interval, m.opts.MinInterval.Round(time.Millisecond))
+		return
+	}
+	log.Printf("Warning: collecting takes %s, more than the %s interval, so samples are %s apart. Use a larger -interval, e.g. %s, or -interval-adaptive", median.Round(time.Millisecond), m.opts.Interval, (median + m.opts.Interval).Round(time.Millisecond), (2 * median).Round(100*time.Millisecond))
+}
+
+// failedMeasurement is the measurement of a sample started at start whose
+// query failed: only its timestamp, Failed and RoundTrip are set, so that
+// charts show a gap rather than zero connections.
+func failedMeasurement(start time.Time) Measurement {
+	return Measurement{Timestamp: start, Failed: true, RoundTrip: time.Since(start)}
+}
+
+// Collect takes a single measurement. Query errors are logged and yield a
+// failed measurement, see failedMeasurement.
+func (m *Monitor) Collect(ctx context.Context) Measurement {
+	return m.collect(ctx, func(name string, err error) {
+		if err != nil {
+			log.Printf("Error querying %s: %v", name, err)
+			m.onError(name, err)
+		}
+	})
+}
+
+// onError passes the error of the query collecting name to Options.OnError,
+// if set.
+func (m *Monitor) onError(name string, err error) {
+	if m.opts.OnError != nil {
+		m.opts.OnError(name, err)
+	}
+}
+
+// connectionsStep is the Step of the connections query, the one query a
+// sample fails without.
+const connectionsStep = "connections"
+
+// Step is the outcome of one of the queries of a sample, see Verify.
+type Step struct {
+	Name string
+	Err  error
+}
+
+// Verify takes a single measurement like Collect, but returns the outcome
+// of every query it ran instead of logging errors.
+func (m *Monitor) Verify(ctx context.Context) (Measurement, []Step) {
+	var steps []Step
+	measurement := m.collect(ctx, func(name string, err error) {
+		steps = append(steps, Step{Name: name, Err: err})
+	})
+	return measurement, steps
+}
+
+// collect takes a single measurement, reporting the outcome of every query
+// to report. A ClickHouseSource fills the fields of the Measurement itself,
+// other sources their Measurement.Metrics.
+func (m *Monitor) collect(ctx context.Context, report func(name string, err error)) Measurement {
+	var measurement Measurement
+	if m.clickhouse != nil {
+		measurement = m.clickhouse.measure(ctx, report)
+	} else {
+		measurement = m.collectSource(ctx, report)
+	}
+	measurement.Elapsed = measurement.Timestamp.Sub(m.created)
+	return measurement
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateSystemDB checks that db is a plain identifier, so that it can be
+// safely interpolated into queries.
+func ValidateSystemDB(db string) error {
+	if !identifierRegexp.MatchString(db) {
+		return fmt.Errorf("invalid database %q", db)
+	}
+	return nil
+}
+
+// systemTable returns the quoted name of a system table in db, or in
+// DefaultSystemDB if db is empty.
+func systemTable(db, table string) string {
+	if db == "" {
+		db = DefaultSystemDB
+	}
+	return "`" + db + "`." + table
+}
+
+// ClockOffset returns how far the server's clock is ahead of the local one,
+// taking the server's time as of halfway through the query.
+func ClockOffset(ctx context.Context, conn driver.Conn) (time.Duration, error) {
+	var now time.Time
+	start := time.Now()
+	if err := conn.QueryRow(ctx, "SELECT now64(6);").Scan(&now); err != nil {
+		return 0, err
+	}
+	return now.Sub(start.Add(time.Since(start) / 2)), nil
+}
+
+// MaxConnections returns the server's configured max_connections, read from
+// the server_settings table in systemDB (DefaultSystemDB if empty).
+func MaxConnections(ctx context.Context, conn driver.Conn, systemDB string) (int, error) {
+	var value string
+	err := conn.QueryRow(ctx, "SELECT value FROM "+systemTable(systemDB, "server_settings")+" WHERE name = 'max_connections';").Scan(&value)
+	if err != nil {
+		return 0, err
+	}
+	maxConnections, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected max_connections value %q", value)
+	}
+	return maxConnections, nil
+}
+
+// CheckQueryLog returns an error if system.query_log is missing or has no
+// finished queries, in which case query_log-based latencies will be empty.
+func CheckQueryLog(ctx context.Context, conn driver.Conn, systemDB string) error {
+	var count uint64
+	err := conn.QueryRow(ctx, "SELECT count() FROM (SELECT 1 FROM "+systemTable(systemDB, "query_log")+" WHERE type = 'QueryFinish' LIMIT 1);").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("system.query_log has no finished queries, is query_log enabled?")
+	}
+	return nil
+}
+
+// CheckKeeper returns an error if the server is not connected to ZooKeeper
+// or Keeper, as on standalone servers, in which case there are no Keeper
+// metrics to collect.
+func CheckKeeper(ctx context.Context, conn driver.Conn, systemDB string) error {
+	var count uint64
+	err := conn.QueryRow(ctx, "SELECT count() FROM "+systemTable(systemDB, "zookeeper_connection")+";").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no ZooKeeper or Keeper connection")
+	}
+	return nil
+}
+
+// CheckDistributed returns an error if the server has no Distributed
+// tables, in which case there is no insert backlog to collect.
+func CheckDistributed(ctx context.Context, conn driver.Conn, systemDB string) error {
+	var count uint64
+	err := conn.QueryRow(ctx, "SELECT count() FROM "+systemTable(systemDB, "tables")+" WHERE engine = 'Distributed';").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no Distributed tables")
+	}
+	return nil
+}
+
+// Backfill reads the history the server recorded in system.metric_log over
+// the last d, to seed a series with history from before collection
+// started: the connection counts, the Options.ProfileEvents, and the values
+// of Options.Keeper, QueryQueue and Distributed. metric_log has nothing
+// else, so backfilled measurements are marked Backfilled, and the other
+// optional values that opts collects are marked as missing, see
+// Measurement.ActiveQueriesFailed. It fails if metric_log is disabled.
+func Backfill(ctx context.Context, conn driver.Conn, opts Options, d time.Duration) ([]Measurement, error) {
+	opts = opts.withDefaults()
+	columns := []string{"CurrentMetric_TCPConnection + CurrentMetric_HTTPConnection"}
+	if opts.Keeper {
+		columns = append(columns, "CurrentMetric_ZooKeeperSession", "CurrentMetric_ZooKeeperRequest")
+	}
+	if opts.QueryQueue {
+		columns = append(columns, "CurrentMetric_Query", "CurrentMetric_QueryPreempted")
+	}
+	if opts.Distributed {
+		columns = append(columns, "CurrentMetric_DistributedSend", "CurrentMetric_DistributedFilesToInsert")
+	}
+	// ProfileEvents are validated against system.events, but still end up
+	// in a column name
+	var events []string
+	for _, event := range opts.ProfileEvents {
+		if identifierRegexp.MatchString(event) {
+			events = append(events, event)
+			columns = append(columns, "ProfileEvent_"+event)
+		}
+	}
+	rows, err := conn.Query(ctx, fmt.Sprintf(`
+		SELECT event_time_microseconds, %s
+		FROM %s
+		WHERE event_time_microseconds > now64(6) - toIntervalMillisecond(%d)
+		ORDER BY event_time_microseconds;`, strings.Join(columns, ", "), systemTable(opts.SystemDB, "metric_log"), d.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var measurements []Measurement
+	// increments holds the ProfileEvents of each second, which metric_log
+	// records rather than the counters
+	var increments [][]uint64
+	for rows.Next() {
+		var timestamp time.Time
+		values := make([]number, len(columns))
+		dest := []any{&timestamp}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		m := Measurement{
+			Timestamp:             timestamp,
+			Backfilled:            true,
+			Connections:           values[0].int(),
+			ActiveQueriesFailed:   opts.ConnectionSource == ConnectionsBoth,
+			DistinctClientsFailed: opts.CountDistinctClients,
+			TableRowsFailed:       opts.WatchTable != "",
+			DashboardValueFailed:  opts.DashboardQuery != "",
+		}
+		next := values[1:]
+		if opts.Keeper {
+			m.KeeperSessions, m.KeeperRequests, next = next[0].int(), next[1].int(), next[2:]
+		}
+		if opts.QueryQueue {
+			m.QueriesRunning, m.QueriesWaiting, next = next[0].int(), next[1].int(), next[2:]
+		}
+		if opts.Distributed {
+			m.DistributedSends, m.DistributedFilesToInsert, next = next[0].int(), next[1].int(), next[2:]
+		}
+		second := make([]uint64, len(events))
+		for i := range events {
+			second[i] = next[i].uint64()
+		}
+		measurements = append(measurements, m)
+		increments = append(increments, second)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || len(measurements) == 0 {
+		return measurements, nil
+	}
+
+	// Rebuild the counters back from their current values, so that the
+	// rates of the live samples continue those of the backfilled ones
+	current, err := (&ClickHouseSource{conn: conn, opts: opts}).profileEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, event := range events {
+		counter := current[event]
+		for j := len(measurements) - 1; j >= 0; j-- {
+			if measurements[j].ProfileEvents == nil {
+				measurements[j].ProfileEvents = make(map[string]uint64, len(events))
+			}
+			measurements[j].ProfileEvents[event] = counter
+			counter -= min(counter, increments[j][i])
+		}
+	}
+	return measurements, nil
+}
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\.[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateTable checks that table is a plain db.table identifier, so that it
+// can be safely interpolated into queries.
+func ValidateTable(table string) error {
+	if !tableNameRegexp.MatchString(table) {
+		return fmt.Errorf("invalid table %q: expected db.table", table)
+	}
+	return nil
+}
+
+func quoteTable(table string) string {
+	db, name, _ := strings.Cut(table, ".")
+	return "`" + db + "`.`" + name + "`"
+}
+
+// ValidateWatchExpr checks that expr, an Options.WatchExpr, is a single
+// expression, so that it cannot smuggle in another statement. Like
+// ValidateReadOnlyQuery it is not a parser.
+func ValidateWatchExpr(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty expression")
+	}
+	if err := ValidateReadOnlyQuery("SELECT " + expr); err != nil {
+		return fmt.Errorf("invalid expression %q: a single expression is expected, e.g. sum(amount)", expr)
+	}
+	return nil
+}
+
+// TableTotalRows returns the total_rows system.tables reports for table,
+// given as db.table, without reading it, and false if the engine does not
+// track it.
+func TableTotalRows(ctx context.Context, conn driver.Conn, systemDB, table string) (uint64, bool, error) {
+	db, name, _ := strings.Cut(table, ".")
+	var rows number
+	err := conn.QueryRow(ctx, "SELECT total_rows FROM "+systemTable(systemDB, "tables")+" WHERE database = ? AND name = ?;", db, name).Scan(&rows)
+	if err != nil {
+		return 0, false, fmt.Errorf("table %s not found: %v", table, err)
+	}
+	return rows.uint64(), rows.valid, nil
+}
+
+// TableEngine returns the engine of table, given as db.table.
+func TableEngine(ctx context.Context, conn driver.Conn, systemDB, table string) (string, error) {
+	db, name, _ := strings.Cut(table, ".")
+	var engine string
+	err := conn.QueryRow(ctx, "SELECT engine FROM "+systemTable(systemDB, "tables")+" WHERE database = ? AND name = ?;", db, name).Scan(&engine)
+	if err != nil {
+		return "", fmt.Errorf("table %s not found: %v", table, err)
+	}
+	return engine, nil
+}
@@ -0,0 +1,90 @@
+//go:build integration
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Run with: go test -tags integration ./monitor
+func TestCollectAgainstClickHouse(t *testing.T) {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "clickhouse/clickhouse-server:latest",
+			ExposedPorts: []string{"9000/tcp"},
+			WaitingFor:   wait.ForListeningPort("9000/tcp").WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { container.Terminate(ctx) })
+
+	endpoint, err := container.PortEndpoint(ctx, "9000/tcp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := clickhouse.ParseDSN(fmt.Sprintf("clickhouse://default@%s", endpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := clickhouse.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(conn, Options{
+		Interval:             50 * time.Millisecond,
+		CountDistinctClients: true,
+		ProfileEvents:        []string{"Query"},
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	m.Start(ctx)
+
+	var measurements []Measurement
+	for measurement := range m.Measurements() {
+		measurements = append(measurements, measurement)
+		if len(measurements) == 5 {
+			cancel()
+		}
+	}
+
+	for i, measurement := range measurements {
+		t.Run(fmt.Sprintf("sample %d", i), func(t *testing.T) {
+			if measurement.QueryDuration <= 0 {
+				t.Errorf("expected a query duration, the metric query probably failed")
+			}
+			// The monitor's own connection is always open
+			if measurement.Connections < 1 {
+				t.Errorf("expected at least 1 connection, got %d", measurement.Connections)
+			}
+			if measurement.DistinctClients < 1 {
+				t.Errorf("expected at least 1 distinct client, got %d", measurement.DistinctClients)
+			}
+			if measurement.ProfileEvents["Query"] == 0 {
+				t.Errorf("expected the Query counter to count the monitor's queries")
+			}
+		})
+	}
+
+	if err := RenderChart(io.Discard, measurements, ChartOptions{DistinctClients: true, ProfileEvents: []string{"Query"}}); err != nil {
+		t.Errorf("rendering chart: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"math"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+// Normalization rescales each series on its own, so that the shapes of
+// series with very different magnitudes can be compared.
+type Normalization string
+
+const (
+	NormalizeNone Normalization = ""
+	// NormalizeMax scales each series to a percentage of its own maximum.
+	NormalizeMax Normalization = "max"
+	// NormalizeZScore expresses each value as standard deviations from the
+	// series mean.
+	NormalizeZScore Normalization = "zscore"
+)
+
+// axisLabel returns the Y axis label for normalized series, or label if
+// series are not normalized.
+func (n Normalization) axisLabel(label string) string {
+	switch n {
+	case NormalizeMax:
+		return "% of series max"
+	case NormalizeZScore:
+		return "z-score"
+	}
+	return label
+}
+
+// apply returns a rescaled copy of pts. A constant series maps to zero, and
+// NaN or infinite points, i.e. gaps, are left as they are.
+func (n Normalization) apply(pts plotter.XYs) plotter.XYs {
+	if n == NormalizeNone || len(pts) == 0 {
+		return pts
+	}
+
+	out := make(plotter.XYs, len(pts))
+	copy(out, pts)
+	switch n {
+	case NormalizeMax:
+		peak := 0.0
+		for _, pt := range pts {
+			if isFinite(pt.Y) {
+				peak = math.Max(peak, math.Abs(pt.Y))
+			}
+		}
+		for i := range out {
+			if !isFinite(pts[i].Y) {
+				continue
+			}
+			if peak > 0 {
+				out[i].Y = 100 * pts[i].Y / peak
+			} else {
+				out[i].Y = 0
+			}
+		}
+	case NormalizeZScore:
+		var sum, sumSq float64
+		n := 0
+		for _, pt := range pts {
+			if isFinite(pt.Y) {
+				sum += pt.Y
+				sumSq += pt.Y * pt.Y
+				n++
+			}
+		}
+		mean := sum / float64(max(n, 1))
+		std := math.Sqrt(math.Max(0, sumSq/float64(max(n, 1))-mean*mean))
+		for i := range out {
+			if !isFinite(pts[i].Y) {
+				continue
+			}
+			if std > 0 {
+				out[i].Y = (pts[i].Y - mean) / std
+			} else {
+				out[i].Y = 0
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// errNull is the error of a sample whose connections query returned NULL.
+var errNull = errors.New("the query returned NULL")
+
+// number scans a metric value of any numeric type, or NULL, where scanning
+// into an int64 fails on e.g. the Float64 values of
+// system.asynchronous_metrics or a Nullable column.
+type number struct {
+	// valid is false for NULL.
+	valid bool
+	float float64
+	// uint is the exact value of a non-negative integer, as float loses
+	// precision above 2^53, e.g. on byte counters.
+	uint     uint64
+	integral bool
+}
+
+// Scan implements sql.Scanner, which the driver falls back to for types it
+// cannot convert itself.
+func (n *number) Scan(src any) error {
+	*n = number{}
+	if src == nil {
+		return nil
+	}
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n.valid, n.float = true, float64(v.Int())
+		if v.Int() >= 0 {
+			n.uint, n.integral = uint64(v.Int()), true
+		}
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n.valid, n.float, n.uint, n.integral = true, float64(v.Uint()), v.Uint(), true
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n.valid, n.float = true, v.Float()
+		return nil
+	}
+	// e.g. Decimal, Int128 and UInt256
+	if s, ok := src.(fmt.Stringer); ok {
+		if f, err := strconv.ParseFloat(s.String(), 64); err == nil {
+			n.valid, n.float = true, f
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot read %T value %v as a number", src, src)
+}
+
+// int returns the value rounded to the nearest integer, and 0 if NaN.
+// Values out of the range of int are clamped to it.
+func (n number) int() int {
+	switch {
+	case n.integral:
+		return int(min(n.uint, math.MaxInt))
+	case math.IsNaN(n.float):
+		return 0
+	case n.float >= math.MaxInt:
+		return math.MaxInt
+	case n.float <= math.MinInt:
+		return math.MinInt
+	}
+	return int(math.Round(n.float))
+}
+
+// uint64 returns the value rounded to the nearest integer, and 0 if
+// negative or NaN. Values above the range of uint64 are clamped to it.
+func (n number) uint64() uint64 {
+	switch {
+	case n.integral:
+		return n.uint
+	case !(n.float > 0):
+		return 0
+	case n.float >= math.MaxUint64:
+		return math.MaxUint64
+	}
+	return uint64(math.Round(n.float))
+}
+
+// MarshalJSON records the value in a DumpRecord, as null for NULL.
+func (n number) MarshalJSON() ([]byte, error) {
+	switch {
+	case !n.valid:
+		return []byte("null"), nil
+	case n.integral:
+		return strconv.AppendUint(nil, n.uint, 10), nil
+	case math.IsNaN(n.float) || math.IsInf(n.float, 0):
+		return strconv.AppendQuote(nil, strconv.FormatFloat(n.float, 'g', -1, 64)), nil
+	}
+	return strconv.AppendFloat(nil, n.float, 'g', -1, 64), nil
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+)
+
+// decimal stands in for the driver's Decimal and big integer types, which
+// only implement fmt.Stringer.
+type decimal string
+
+func (d decimal) String() string { return string(d) }
+
+func TestNumberScan(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    any
+		valid  bool
+		int    int
+		uint64 uint64
+		ok     bool
+	}{
+		{"NULL", nil, false, 0, 0, true},
+		{"int", int64(42), true, 42, 42, true},
+		{"negative int", int32(-5), true, -5, 0, true},
+		{"uint", uint8(7), true, 7, 7, true},
+		{"uint64 above 2^53", uint64(1<<53 + 1), true, 1<<53 + 1, 1<<53 + 1, true},
+		{"uint64 above MaxInt", uint64(math.MaxUint64), true, math.MaxInt, math.MaxUint64, true},
+		{"float", 2.5, true, 3, 3, true},
+		{"negative float", float32(-2.5), true, -3, 0, true},
+		{"NaN", math.NaN(), true, 0, 0, true},
+		{"overflowing float", 1e30, true, math.MaxInt, math.MaxUint64, true},
+		{"overflowing negative float", -1e30, true, math.MinInt, 0, true},
+		{"infinity", math.Inf(1), true, math.MaxInt, math.MaxUint64, true},
+		{"decimal", decimal("12.75"), true, 13, 13, true},
+		{"not a number", decimal("many"), false, 0, 0, false},
+		{"string", "12", false, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n number
+			err := n.Scan(tt.src)
+			if tt.ok != (err == nil) {
+				t.Fatalf("Scan(%v) error = %v, want ok %v", tt.src, err, tt.ok)
+			}
+			if n.valid != tt.valid {
+				t.Errorf("Scan(%v) valid = %v, want %v", tt.src, n.valid, tt.valid)
+			}
+			if got := n.int(); got != tt.int {
+				t.Errorf("Scan(%v) int() = %d, want %d", tt.src, got, tt.int)
+			}
+			if got := n.uint64(); got != tt.uint64 {
+				t.Errorf("Scan(%v) uint64() = %d, want %d", tt.src, got, tt.uint64)
+			}
+		})
+	}
+
+	// Scan resets a number that is reused across rows
+	n := number{valid: true, float: 1}
+	n.Scan(nil)
+	if n.valid || n.int() != 0 {
+		t.Errorf("Scan(nil) after a value = %+v, want NULL", n)
+	}
+}
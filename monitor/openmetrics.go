@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidateLabels checks that tags are valid Prometheus/OpenMetrics label
+// names, which excludes the reserved __ prefix.
+func ValidateLabels(tags map[string]string) error {
+	for name := range tags {
+		if !labelNameRegexp.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// formatLabels formats tags, plus an optional extra label, as an
+// OpenMetrics label set, e.g. {env="prod",quantile="0.5"}.
+func formatLabels(tags map[string]string, extraName, extraValue string) string {
+	all := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		all[k] = v
+	}
+	if extraName != "" {
+		all[extraName] = extraValue
+	}
+	if len(all) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escaper.Replace(all[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteOpenMetrics writes the whole series as timestamped samples in the
+// OpenMetrics text format, for tools that ingest exposition files. Every
+// sample is labelled with tags. Optional series are only included if they
+// were collected.
+func WriteOpenMetrics(w io.Writer, measurements []Measurement, tags map[string]string) error {
+	bw := bufio.NewWriter(w)
+	labels := formatLabels(tags, "", "")
+
+	family := func(name, unit, help string) {
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		if unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", name, unit)
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+	}
+	sample := func(name, labels string, value float64, t time.Time) {
+		fmt.Fprintf(bw, "%s%s %g %.3f\n", name, labels, value, float64(t.UnixMilli())/1000)
+	}
+
+	family("clickhouse_monitor_connections", "", "Active TCP and HTTP connections.")
+	for _, m := range measurements {
+		sample("clickhouse_monitor_connections", labels, float64(m.Connections), m.Timestamp)
+	}
+
+	family("clickhouse_monitor_query_duration_seconds", "seconds", "Duration of the monitor's own metric query.")
+	for _, m := range measurements {
+		if !m.Backfilled {
+			sample("clickhouse_monitor_query_duration_seconds", labels, m.QueryDuration.Seconds(), m.Timestamp)
+		}
+	}
+
+	if collected(measurements, func(m Measurement) bool { return m.DistinctClients != 0 }) {
+		family("clickhouse_monitor_distinct_clients", "", "Distinct client hosts with a running query.")
+		for _, m := range measurements {
+			if !m.DistinctClientsFailed {
+				sample("clickhouse_monitor_distinct_clients", labels, float64(m.DistinctClients), m.Timestamp)
+			}
+		}
+	}
+
+	if collected(measurements, func(m Measurement) bool { return m.QueryP99 != 0 }) {
+		family("clickhouse_monitor_query_log_duration_seconds", "seconds", "Percentiles of user query durations from system.query_log.")
+		for _, q := range []struct {
+			quantile string
+			value    func(Measurement) time.Duration
+		}{
+			{"0.5", func(m Measurement) time.Duration { return m.QueryP50 }},
+			{"0.99", func(m Measurement) time.Duration { return m.QueryP99 }},
+		} {
+			quantileLabels := formatLabels(tags, "quantile", q.quantile)
+			for _, m := range measurements {
+				if m.Backfilled {
+					continue
+				}
+				sample("clickhouse_monitor_query_log_duration_seconds", quantileLabels, q.value(m).Seconds(), m.Timestamp)
+			}
+		}
+	}
+
+	fmt.Fprintln(bw, "# EOF")
+	return bw.Flush()
+}
+
+// collected reports whether any measurement has an optional series set.
+func collected(measurements []Measurement, has func(Measurement) bool) bool {
+	for _, m := range measurements {
+		if has(m) {
+			return true
+		}
+	}
+	return false
+}
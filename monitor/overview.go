@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// overviewPlot returns the Overview subplot: the key series of the chart,
+// each as a percentage of its own maximum, so that they can be compared at
+// a glance above their own subplots.
+func overviewPlot(measurements []Measurement, opts ChartOptions) (*plot.Plot, error) {
+	type signal struct {
+		name string
+		pts  plotter.XYs
+	}
+	of := func(value func(Measurement) float64) plotter.XYs { return series(measurements, value) }
+	latency := func(m Measurement) float64 { return orGap(float64(m.QueryDuration), m.Backfilled) }
+	if opts.QueryLogLatency {
+		latency = func(m Measurement) float64 { return orGap(float64(m.QueryP99), m.Backfilled) }
+	}
+	signals := []signal{
+		{"connections", of(func(m Measurement) float64 { return float64(m.Connections) })},
+		{"query duration", of(latency)},
+	}
+	if opts.ConnectionSource == ConnectionsBoth {
+		signals = append(signals, signal{"active queries", of(func(m Measurement) float64 { return orGap(float64(m.ActiveQueries), m.ActiveQueriesFailed) })})
+	}
+	if opts.DistinctClients {
+		signals = append(signals, signal{"distinct clients", of(func(m Measurement) float64 { return orGap(float64(m.DistinctClients), m.DistinctClientsFailed) })})
+	}
+	if opts.QueryQueue {
+		signals = append(signals, signal{"queries running", of(func(m Measurement) float64 { return orGap(float64(m.QueriesRunning), m.QueryQueueFailed) })})
+	}
+	if opts.Distributed {
+		signals = append(signals, signal{"distributed backlog", of(func(m Measurement) float64 { return orGap(float64(m.DistributedFilesToInsert), m.DistributedFailed) })})
+	}
+	if opts.Keeper {
+		signals = append(signals, signal{"Keeper requests", of(func(m Measurement) float64 { return orGap(float64(m.KeeperRequests), m.KeeperFailed) })})
+	}
+	if opts.WatchTable != "" {
+		signals = append(signals, signal{opts.WatchTable + " rows", of(tableRows)})
+	}
+	if opts.Dashboard != "" {
+		signals = append(signals, signal{opts.Dashboard, of(func(m Measurement) float64 { return orGap(m.DashboardValue, m.DashboardValueFailed) })})
+	}
+
+	overview := newSubplot("Overview", NormalizeMax.axisLabel(""))
+	// Thin lines without glyphs, rescaled whatever ChartOptions.Normalize
+	lineOpts := opts
+	lineOpts.Normalize = NormalizeMax
+	lineOpts.Points = PointsNever
+	for i, s := range signals {
+		if err := addNamedSeries(overview, s.pts, i, s.name, lineOpts); err != nil {
+			return nil, err
+		}
+	}
+	overview.Y.Min, overview.Y.Max = 0, 100
+	overview.Legend.Top = true
+	overview.Legend.Left = true
+	overview.Legend.TextStyle.Font.Size = vg.Points(8)
+	overview.Legend.ThumbnailWidth = vg.Points(12)
+	return overview, nil
+}
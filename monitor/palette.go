@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+)
+
+// Palette recolors a chart, e.g. to match a team's dashboards. Every series
+// takes the next of Series, where by default only series sharing a subplot
+// are colored.
+type Palette struct {
+	Background color.Color
+	// Text colors titles, labels and the axes.
+	Text   color.Color
+	Grid   color.Color
+	Series []color.Color
+}
+
+// BuiltinPalettes are the palettes that LoadPalette accepts by name.
+var BuiltinPalettes = map[string]Palette{
+	"light": {
+		Background: color.White,
+		Text:       color.Black,
+		Grid:       color.Gray{Y: 220},
+		Series:     plotutil.SoftColors,
+	},
+	"dark": {
+		Background: color.RGBA{R: 0x1e, G: 0x1e, B: 0x24, A: 0xff},
+		Text:       color.RGBA{R: 0xd8, G: 0xd9, B: 0xda, A: 0xff},
+		Grid:       color.RGBA{R: 0x3a, G: 0x3b, B: 0x42, A: 0xff},
+		Series: []color.Color{
+			color.RGBA{R: 0x73, G: 0xbf, B: 0x69, A: 0xff},
+			color.RGBA{R: 0xf2, G: 0xcc, B: 0x0c, A: 0xff},
+			color.RGBA{R: 0x8a, G: 0xb8, B: 0xff, A: 0xff},
+			color.RGBA{R: 0xff, G: 0x78, B: 0x83, A: 0xff},
+			color.RGBA{R: 0xca, G: 0x95, B: 0xe5, A: 0xff},
+		},
+	},
+}
+
+// PaletteNames returns the names of BuiltinPalettes, sorted.
+func PaletteNames() []string {
+	names := make([]string, 0, len(BuiltinPalettes))
+	for name := range BuiltinPalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPalette returns the built-in palette called name, or else reads the
+// palette file name, see ParsePalette.
+func LoadPalette(name string) (Palette, error) {
+	if p, ok := BuiltinPalettes[name]; ok {
+		return p, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return Palette{}, fmt.Errorf("not a built-in palette (%s) or a readable file: %v", strings.Join(PaletteNames(), ", "), err)
+	}
+	defer f.Close()
+	return ParsePalette(f)
+}
+
+// ParsePalette parses a palette file of key = value lines, where the keys
+// are background, text, grid and series, and colors are #rrggbb. series is
+// a comma-separated list. Blank lines and lines starting with # are
+// ignored, and keys left out keep the light palette's colors.
+func ParsePalette(r io.Reader) (Palette, error) {
+	p := BuiltinPalettes["light"]
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return Palette{}, fmt.Errorf("line %d: expected key = value", line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "background":
+			p.Background, err = parseColor(value)
+		case "text":
+			p.Text, err = parseColor(value)
+		case "grid":
+			p.Grid, err = parseColor(value)
+		case "series":
+			p.Series = nil
+			for _, v := range strings.Split(value, ",") {
+				c, cerr := parseColor(strings.TrimSpace(v))
+				if cerr != nil {
+					err = cerr
+					break
+				}
+				p.Series = append(p.Series, c)
+			}
+		default:
+			err = fmt.Errorf("unknown key %q, expected background, text, grid or series", key)
+		}
+		if err != nil {
+			return Palette{}, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Palette{}, err
+	}
+	if len(p.Series) == 0 {
+		return Palette{}, fmt.Errorf("series needs at least one color")
+	}
+	return p, nil
+}
+
+// parseColor parses a #rrggbb color.
+func parseColor(s string) (color.Color, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// series returns the color of the i-th series.
+func (p *Palette) series(i int) color.Color {
+	return p.Series[i%len(p.Series)]
+}
+
+// style colors the background, text and axes of plot.
+func (p *Palette) style(pl *plot.Plot) {
+	pl.BackgroundColor = p.Background
+	pl.Title.TextStyle.Color = p.Text
+	pl.Legend.TextStyle.Color = p.Text
+	for _, axis := range []*plot.Axis{&pl.X, &pl.Y} {
+		axis.Label.TextStyle.Color = p.Text
+		axis.LineStyle.Color = p.Text
+		axis.Tick.Label.Color = p.Text
+		axis.Tick.LineStyle.Color = p.Text
+	}
+}
+
+// styleGrid colors grid.
+func (p *Palette) styleGrid(grid *plotter.Grid) {
+	grid.Vertical.Color = p.Grid
+	grid.Horizontal.Color = p.Grid
+}
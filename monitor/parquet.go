@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is a Measurement as a Parquet row, with durations in
+// nanoseconds like the CSV output. The values of the optional queries are
+// NULL where their query failed, and the durations where the measurement
+// was backfilled.
+type parquetRow struct {
+	Timestamp                time.Time         `parquet:"timestamp,timestamp(microsecond)"`
+	Connections              int64             `parquet:"connections"`
+	ConnectionsAvg           float64           `parquet:"connections_avg"`
+	QueryDurationNs          *int64            `parquet:"query_duration_ns,optional"`
+	Failed                   bool              `parquet:"failed"`
+	RoundTripNs              *int64            `parquet:"round_trip_ns,optional"`
+	ActiveQueries            *int64            `parquet:"active_queries,optional"`
+	DistinctClients          *int64            `parquet:"distinct_clients,optional"`
+	QueryP50Ns               *int64            `parquet:"query_p50_ns,optional"`
+	QueryP99Ns               *int64            `parquet:"query_p99_ns,optional"`
+	TableRows                *int64            `parquet:"table_rows,optional"`
+	DashboardValue           *float64          `parquet:"dashboard_value,optional"`
+	KeeperSessions           *int64            `parquet:"keeper_sessions,optional"`
+	KeeperRequests           *int64            `parquet:"keeper_requests,optional"`
+	QueriesRunning           *int64            `parquet:"queries_running,optional"`
+	QueriesWaiting           *int64            `parquet:"queries_waiting,optional"`
+	DistributedSends         *int64            `parquet:"distributed_sends,optional"`
+	DistributedFilesToInsert *int64            `parquet:"distributed_files_to_insert,optional"`
+	ProfileEvents            map[string]int64  `parquet:"profile_events"`
+	Tags                     map[string]string `parquet:"tags"`
+}
+
+// WriteParquet writes the raw measurements as a Parquet file with typed
+// columns, for analysis in pandas, DuckDB or ClickHouse itself. Every row
+// carries tags.
+func WriteParquet(w io.Writer, measurements []Measurement, tags map[string]string) error {
+	pw := parquet.NewGenericWriter[parquetRow](w, parquet.Compression(&parquet.Zstd))
+	rows := make([]parquetRow, len(measurements))
+	for i, m := range measurements {
+		rows[i] = parquetRow{
+			Timestamp:                m.Timestamp,
+			Connections:              int64(m.Connections),
+			ConnectionsAvg:           m.ConnectionsAvg,
+			QueryDurationNs:          orNull(int64(m.QueryDuration), m.Backfilled),
+			Failed:                   m.Failed,
+			RoundTripNs:              orNull(int64(m.RoundTrip), m.Backfilled),
+			ActiveQueries:            orNull(int64(m.ActiveQueries), m.ActiveQueriesFailed),
+			DistinctClients:          orNull(int64(m.DistinctClients), m.DistinctClientsFailed),
+			QueryP50Ns:               orNull(int64(m.QueryP50), m.Backfilled),
+			QueryP99Ns:               orNull(int64(m.QueryP99), m.Backfilled),
+			TableRows:                orNull(int64(m.TableRows), m.TableRowsFailed),
+			DashboardValue:           orNull(m.DashboardValue, m.DashboardValueFailed),
+			KeeperSessions:           orNull(int64(m.KeeperSessions), m.KeeperFailed),
+			KeeperRequests:           orNull(int64(m.KeeperRequests), m.KeeperFailed),
+			QueriesRunning:           orNull(int64(m.QueriesRunning), m.QueryQueueFailed),
+			QueriesWaiting:           orNull(int64(m.QueriesWaiting), m.QueryQueueFailed),
+			DistributedSends:         orNull(int64(m.DistributedSends), m.DistributedFailed),
+			DistributedFilesToInsert: orNull(int64(m.DistributedFilesToInsert), m.DistributedFailed),
+			Tags:                     tags,
+		}
+		if len(m.ProfileEvents) > 0 {
+			rows[i].ProfileEvents = make(map[string]int64, len(m.ProfileEvents))
+			for name, value := range m.ProfileEvents {
+				rows[i].ProfileEvents[name] = int64(value)
+			}
+		}
+	}
+	if _, err := pw.Write(rows); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// orNull returns a pointer to v, or nil if v is missing.
+func orNull[T any](v T, failed bool) *T {
+	if failed {
+		return nil
+	}
+	return &v
+}
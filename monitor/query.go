@@ -0,0 +1,302 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	sqlCommentRegexp   = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/`)
+	readOnlyStartRegex = regexp.MustCompile(`(?i)^(SELECT|WITH)\b`)
+)
+
+// ValidateReadOnlyQuery checks that a user-supplied query is a single SELECT
+// statement, so that the monitor never runs anything that could write. It is
+// a simple prefix check, not a parser, and errs on the side of refusing.
+func ValidateReadOnlyQuery(query string) error {
+	q := strings.TrimSpace(sqlCommentRegexp.ReplaceAllString(query, " "))
+	q = strings.TrimSpace(strings.TrimSuffix(q, ";"))
+	if !readOnlyStartRegex.MatchString(q) {
+		return fmt.Errorf("only SELECT queries are allowed, got %q", query)
+	}
+	if strings.Contains(q, ";") {
+		return fmt.Errorf("only a single statement is allowed, got %q", query)
+	}
+	return nil
+}
+
+// token is a lexical token of a query: a word, either a keyword or an
+// identifier, a string literal, a number or a punctuation character.
+type token struct {
+	text string
+	// quoted is whether the word was a "quoted" or `quoted` identifier, which
+	// is never a keyword.
+	quoted bool
+	kind   tokenKind
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+// keyword reports whether t is the unquoted keyword kw.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokenWord && !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+func (t token) punct(p string) bool {
+	return t.kind == tokenPunct && t.text == p
+}
+
+// tokenize splits query into tokens, dropping comments and unquoting
+// identifiers. It fails on what it cannot account for, e.g. an unterminated
+// string, rather than guess where the server would end it.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			text, n, err := unquote(query[i:])
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenString
+			if c != '\'' {
+				kind = tokenWord
+			}
+			tokens = append(tokens, token{text: text, quoted: c != '\'', kind: kind})
+			i += n
+		case isWordByte(c) && !isDigit(c):
+			n := 1
+			for i+n < len(query) && isWordByte(query[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{text: query[i : i+n], kind: tokenWord})
+			i += n
+		case isDigit(c):
+			n := 1
+			for i+n < len(query) && (isWordByte(query[i+n]) || query[i+n] == '.') {
+				n++
+			}
+			tokens = append(tokens, token{text: query[i : i+n], kind: tokenNumber})
+			i += n
+		default:
+			tokens = append(tokens, token{text: string(c), kind: tokenPunct})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// unquote returns the string literal or quoted identifier at the start of s,
+// unescaped, and its length in s. Quotes are escaped by a backslash or by
+// doubling them.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+			b.WriteByte(quote)
+		case s[i] == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated %c quote", quote)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z') || c >= 0x80
+}
+
+// clauseKeywords end the list of tables of a FROM or JOIN clause, unless
+// used as an alias after AS. ON and USING do not, as a comma after the join
+// condition starts another table.
+var clauseKeywords = []string{"WHERE", "PREWHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "SETTINGS", "FORMAT", "UNION", "EXCEPT", "INTERSECT", "WINDOW", "QUALIFY", "INTO", "JOIN", "ARRAY", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "GLOBAL", "ANY", "ALL", "ASOF", "SEMI", "ANTI", "PASTE"}
+
+// nameFunctions are the functions that read a table or dictionary named by
+// their arguments, which cannot be checked.
+var nameFunctions = []string{"joinget", "joingetornull", "hascolumnintable", "dictget", "dicthas", "dictisin"}
+
+// tableName reads the table, db.table or table function name() at tokens[i],
+// and returns it with the index of the token after it.
+func tableName(tokens []token, i int) (string, int, error) {
+	parts := []string{}
+	for {
+		if i >= len(tokens) || tokens[i].kind != tokenWord {
+			return "", 0, fmt.Errorf("cannot tell which table the query reads")
+		}
+		if strings.Contains(tokens[i].text, ".") {
+			// A quoted name like `system.one` is a table of the current
+			// database, not one of system
+			return "", 0, fmt.Errorf("cannot tell the database of %q", tokens[i].text)
+		}
+		parts = append(parts, tokens[i].text)
+		i++
+		if len(parts) == 2 || i+1 >= len(tokens) || !tokens[i].punct(".") {
+			break
+		}
+		i++
+	}
+	name := strings.Join(parts, ".")
+	if i < len(tokens) && tokens[i].punct("(") {
+		name += "()"
+	}
+	return name, i, nil
+}
+
+// tableRefs returns every table a query reads: after FROM, including each
+// of a comma-separated list, after JOIN, and after IN, as in IN db.table.
+// Subqueries are covered by their own FROM. It fails on anything it cannot
+// account for.
+func tableRefs(query string) ([]string, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for i, t := range tokens {
+		switch {
+		case t.kind == tokenWord && !t.quoted && i+1 < len(tokens) && tokens[i+1].punct("("):
+			lower := strings.ToLower(t.text)
+			for _, f := range nameFunctions {
+				if lower == f || (strings.HasPrefix(f, "dict") && strings.HasPrefix(lower, f)) {
+					return nil, fmt.Errorf("query calls %s(), which reads a table or dictionary by name", t.text)
+				}
+			}
+		case t.keyword("IN"):
+			// IN (...), IN [...] and IN {param} read no table by name
+			if i+1 < len(tokens) && tokens[i+1].kind == tokenWord {
+				table, _, err := tableName(tokens, i+1)
+				if err != nil {
+					return nil, fmt.Errorf("after IN: %v", err)
+				}
+				tables = append(tables, table)
+			}
+		case t.keyword("JOIN"):
+			if i > 0 && tokens[i-1].keyword("ARRAY") {
+				// ARRAY JOIN unfolds a column, it reads no table
+				continue
+			}
+			join, err := fromTables(tokens, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("after JOIN: %v", err)
+			}
+			tables = append(tables, join...)
+		case t.keyword("FROM"):
+			from, err := fromTables(tokens, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("after FROM: %v", err)
+			}
+			tables = append(tables, from...)
+		}
+	}
+	return tables, nil
+}
+
+// fromTables returns the tables of the FROM or JOIN clause starting at
+// tokens[i], one per comma-separated table expression.
+func fromTables(tokens []token, i int) ([]string, error) {
+	var tables []string
+	for {
+		if i < len(tokens) && tokens[i].punct("(") {
+			// A subquery, whose own FROM is checked on its own
+		} else {
+			table, next, err := tableName(tokens, i)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, table)
+			i = next
+		}
+		// Skip the alias, FINAL, SAMPLE and table function arguments to
+		// the next table of the list or the end of the clause
+		depth, more := 0, false
+	scan:
+		for ; i < len(tokens); i++ {
+			t := tokens[i]
+			switch {
+			case t.punct("("):
+				depth++
+			case t.punct(")"):
+				if depth == 0 {
+					break scan
+				}
+				depth--
+			case depth > 0:
+			case t.punct(","):
+				more = true
+				i++
+				break scan
+			case t.punct(";"):
+				break scan
+			case slices.ContainsFunc(clauseKeywords, t.keyword) && !tokens[i-1].keyword("AS"):
+				break scan
+			}
+		}
+		if !more {
+			return tables, nil
+		}
+	}
+}
+
+// ValidateQueryTables checks that every table a query reads is allowed by
+// one of allowed, given as db.table or db.* patterns. It tokenizes the query
+// rather than parse it, and refuses any query it cannot account for: table
+// functions, e.g. remote(), and tables without a database are refused unless
+// allowed by name, and so are functions reading a table named by a string,
+// e.g. joinGet().
+func ValidateQueryTables(query string, allowed []string) error {
+	tables, err := tableRefs(query)
+	if err != nil {
+		return fmt.Errorf("cannot check the tables the query reads: %v", err)
+	}
+	for _, table := range tables {
+		if !tableAllowed(table, allowed) {
+			return fmt.Errorf("query reads %s, which is not in the allowed tables %s", table, strings.Join(allowed, ","))
+		}
+	}
+	return nil
+}
+
+func tableAllowed(table string, allowed []string) bool {
+	db, _, qualified := strings.Cut(table, ".")
+	for _, pattern := range allowed {
+		if pattern == table || (qualified && pattern == db+".*") {
+			return true
+		}
+	}
+	return false
+}
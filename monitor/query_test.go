@@ -0,0 +1,58 @@
+package monitor
+
+import "testing"
+
+func TestValidateQueryTables(t *testing.T) {
+	allowed := []string{"system.*", "ops.deploys", "merge()"}
+	tests := []struct {
+		name  string
+		query string
+		ok    bool
+	}{
+		{"allowed table", "SELECT count() FROM system.parts WHERE active", true},
+		{"allowed by name", "SELECT ts, label FROM ops.deploys", true},
+		{"other table", "SELECT * FROM default.secret", false},
+		{"table without database", "SELECT * FROM secret", false},
+		{"comma join", "SELECT * FROM system.one, default.secret", false},
+		{"comma join with alias", "SELECT * FROM system.one AS o, default.secret AS s", false},
+		{"comma join after keyword alias", "SELECT * FROM system.one AS left, default.secret", false},
+		{"comma join after join condition", "SELECT * FROM system.one AS a JOIN system.numbers AS b ON a.dummy = b.number, default.secret", false},
+		{"double quoted identifiers", `SELECT * FROM "default"."secret"`, false},
+		{"backquoted identifiers", "SELECT * FROM `default`.`secret`", false},
+		{"quoted allowed table", "SELECT * FROM `system`.`one`", true},
+		{"quoted name with a dot", "SELECT * FROM `system.one`", false},
+		{"IN table", "SELECT 1 FROM system.one WHERE dummy IN default.secret", false},
+		{"GLOBAL NOT IN table", "SELECT 1 FROM system.one WHERE dummy GLOBAL NOT IN default.secret", false},
+		{"IN list", "SELECT 1 FROM system.one WHERE dummy IN (0, 1)", true},
+		{"IN subquery", "SELECT 1 FROM system.one WHERE dummy IN (SELECT dummy FROM default.secret)", false},
+		{"allowed IN subquery", "SELECT 1 FROM system.one WHERE dummy IN (SELECT dummy FROM system.one)", true},
+		{"scalar subquery", "SELECT (SELECT count() FROM default.secret)", false},
+		{"join", "SELECT * FROM system.one JOIN default.secret USING (dummy)", false},
+		{"allowed join", "SELECT * FROM system.one AS a LEFT JOIN system.one AS b ON a.dummy = b.dummy", true},
+		{"join subquery", "SELECT * FROM system.one JOIN (SELECT * FROM default.secret) USING (dummy)", false},
+		{"array join", "SELECT * FROM system.one ARRAY JOIN [1, 2] AS x", true},
+		{"table function", "SELECT * FROM remote('host', default.secret)", false},
+		{"allowed table function", "SELECT * FROM merge('system', '^metric_log') WHERE event_date >= toDate(now() - {seconds:UInt32})", true},
+		{"joinGet", "SELECT joinGet('default.secret', 'v', 1)", false},
+		{"dictGet", "SELECT dictGetString('secrets', 'v', toUInt64(1))", false},
+		{"FROM in string", "SELECT 'FROM default.secret' FROM system.one", true},
+		{"FROM in comment", "SELECT 1 FROM system.one -- FROM default.secret", true},
+		{"escaped quote in string", `SELECT 'a\' FROM default.secret' FROM system.one`, true},
+		{"string ending early", `SELECT 'a\\' FROM default.secret`, false},
+		{"unterminated string", "SELECT 'a FROM system.one", false},
+		{"unterminated comment", "SELECT 1 FROM system.one /* FROM default.secret", false},
+		{"group by list", "SELECT metric, count() FROM system.metrics GROUP BY metric, value", true},
+		{"FROM a parameter", "SELECT * FROM {table:Identifier}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQueryTables(tt.query, allowed)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateQueryTables(%q) = %v, want nil", tt.query, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("ValidateQueryTables(%q) = nil, want an error", tt.query)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package monitor
+
+import "strings"
+
+// QueryLogExclusion leaves queries out of the latency percentiles computed
+// from system.query_log, so that they reflect genuine user traffic rather
+// than the monitor itself or known background queries.
+type QueryLogExclusion struct {
+	// Users are the users whose queries are left out, e.g. a replication
+	// or backup user.
+	Users []string
+	// QueryIDPrefixes leave out the queries whose query_id starts with any
+	// of them.
+	QueryIDPrefixes []string
+}
+
+// where returns the conditions to add to the WHERE clause of a query on
+// system.query_log, each starting with AND, and the arguments they bind.
+func (e QueryLogExclusion) where() (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if len(e.Users) > 0 {
+		conditions = append(conditions, "AND NOT has(?, user)")
+		args = append(args, e.Users)
+	}
+	if len(e.QueryIDPrefixes) > 0 {
+		conditions = append(conditions, "AND NOT arrayExists(prefix -> startsWith(query_id, prefix), ?)")
+		args = append(args, e.QueryIDPrefixes)
+	}
+	return strings.Join(conditions, "\n"), args
+}
+
+// withRunID returns e also leaving out the monitor's own queries, whose
+// query_id starts with runID-, if runID is set.
+func (e QueryLogExclusion) withRunID(runID string) QueryLogExclusion {
+	if runID == "" {
+		return e
+	}
+	e.QueryIDPrefixes = append(append([]string(nil), e.QueryIDPrefixes...), runID+"-")
+	return e
+}
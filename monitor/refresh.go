@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"log"
+	"sync"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+// staleRunLength is the average number of identical consecutive samples
+// above which a series is considered to refresh slower than it's sampled.
+const staleRunLength = 3
+
+// RefreshDetector is a Sink that warns when a series that the server only
+// refreshes periodically, like the system.query_log percentiles, is sampled
+// faster than it updates. Such series show stairsteps that look like real
+// plateaus.
+type RefreshDetector struct {
+	mu     sync.Mutex
+	series map[string]*runTracker
+}
+
+type runTracker struct {
+	last    float64
+	run     int
+	runs    int
+	total   int
+	started bool
+	warned  bool
+}
+
+func NewRefreshDetector() *RefreshDetector {
+	return &RefreshDetector{series: map[string]*runTracker{}}
+}
+
+func (d *RefreshDetector) Write(m Measurement) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if m.QueryP99 != 0 {
+		d.observe("query_log p50", float64(m.QueryP50))
+		d.observe("query_log p99", float64(m.QueryP99))
+	}
+	return nil
+}
+
+func (d *RefreshDetector) observe(name string, v float64) {
+	t, ok := d.series[name]
+	if !ok {
+		t = &runTracker{}
+		d.series[name] = t
+	}
+	if t.started && v == t.last {
+		t.run++
+		return
+	}
+	if t.started {
+		t.runs++
+		t.total += t.run
+	}
+	t.started, t.last, t.run = true, v, 1
+
+	// Only judge after a few changes, so a genuinely flat start isn't flagged
+	if !t.warned && t.runs >= 3 && t.total/t.runs >= staleRunLength {
+		t.warned = true
+		log.Printf("Warning: %s repeats for ~%d samples between changes: sampling faster than the metric refreshes, consider a larger -interval or -dedupe-stale", name, t.total/t.runs)
+	}
+}
+
+// dedupeRuns keeps only the first point of each run of identical
+// consecutive values, plus the last point, so that a coarsely refreshed
+// series is drawn from one update to the next instead of as stairsteps.
+func dedupeRuns(pts plotter.XYs) plotter.XYs {
+	if len(pts) < 3 {
+		return pts
+	}
+	out := plotter.XYs{pts[0]}
+	for i := 1; i < len(pts)-1; i++ {
+		if pts[i].Y != pts[i-1].Y {
+			out = append(out, pts[i])
+		}
+	}
+	return append(out, pts[len(pts)-1])
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Remote is a server observed through the remote() table function of the
+// server the monitor is connected to, for targets that only a gateway
+// node can reach. The credentials are those of the target.
+type Remote struct {
+	// Addr is the host:port of the target's native protocol.
+	Addr     string
+	User     string
+	Password string
+}
+
+// ParseRemoteAddr checks that addr is a host:port for Remote.Addr.
+func ParseRemoteAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid remote address %q: %v", addr, err)
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("invalid remote address %q: expected host:port", addr)
+	}
+	return nil
+}
+
+// table returns remote() reading db.table on the target. Every argument is
+// a quoted string literal, so credentials cannot break out of the query.
+func (r *Remote) table(db, table string) string {
+	return fmt.Sprintf("remote(%s, %s, %s, %s, %s)",
+		quoteString(r.Addr), quoteString(db), quoteString(table), quoteString(r.User), quoteString(r.Password))
+}
+
+// Redact replaces the password in s, e.g. an error echoing a query, so that
+// it never reaches the logs.
+func (r *Remote) Redact(s string) string {
+	if r == nil || r.Password == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, quoteString(r.Password), "'[REDACTED]'")
+	return strings.ReplaceAll(s, r.Password, "[REDACTED]")
+}
+
+// quoteString returns s as a ClickHouse string literal.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
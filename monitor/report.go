@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportBarWidth is the width of the bars of WriteReport, in characters.
+const reportBarWidth = 20
+
+// barBlocks are the eighths of a character that bars end in.
+var barBlocks = []rune(" ▏▎▍▌▋▊▉█")
+
+// ReportRow summarizes the samples of one bucket of BucketReport.
+type ReportRow struct {
+	Start          time.Time
+	Samples        int
+	Errors         int
+	AvgConnections float64
+	QueryP99       time.Duration
+}
+
+// BucketReport summarizes measurements into consecutive buckets of width,
+// aligned to multiples of it. Buckets without samples, e.g. while the
+// monitor was suspended, are kept so that the gaps show. Backfilled samples
+// count towards the connections only, as they have no query duration.
+func BucketReport(measurements []Measurement, width time.Duration) []ReportRow {
+	if len(measurements) == 0 || width <= 0 {
+		return nil
+	}
+	first := measurements[0].Timestamp.Truncate(width)
+	last := measurements[len(measurements)-1].Timestamp.Truncate(width)
+	rows := make([]ReportRow, int(last.Sub(first)/width)+1)
+	durations := make([][]time.Duration, len(rows))
+	connections, ok := make([]int, len(rows)), make([]int, len(rows))
+	for i := range rows {
+		rows[i].Start = first.Add(time.Duration(i) * width)
+	}
+	for _, m := range measurements {
+		i := int(m.Timestamp.Truncate(width).Sub(first) / width)
+		if i < 0 || i >= len(rows) {
+			continue
+		}
+		rows[i].Samples++
+		if m.Failed {
+			rows[i].Errors++
+			continue
+		}
+		connections[i] += m.Connections
+		ok[i]++
+		if !m.Backfilled {
+			durations[i] = append(durations[i], m.QueryDuration)
+		}
+	}
+	for i := range rows {
+		if ok[i] > 0 {
+			rows[i].AvgConnections = float64(connections[i]) / float64(ok[i])
+		}
+		d := durations[i]
+		if len(d) == 0 {
+			continue
+		}
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+		rows[i].QueryP99 = d[int(math.Ceil(0.99*float64(len(d))))-1]
+	}
+	return rows
+}
+
+// WriteReport writes rows as a text table, with bars of the average
+// connections and the p99 query duration scaled to their maximum.
+func WriteReport(w io.Writer, rows []ReportRow) error {
+	var maxConns float64
+	var maxP99 time.Duration
+	for _, r := range rows {
+		maxConns = math.Max(maxConns, r.AvgConnections)
+		maxP99 = max(maxP99, r.QueryP99)
+	}
+	if _, err := fmt.Fprintf(w, "%-8s %7s %9s %-*s %9s %-*s %6s\n", "Bucket", "Samples", "Avg conns", reportBarWidth, "", "p99 (ms)", reportBarWidth, "", "Errors"); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		// Without a successful sample there is nothing to average
+		if r.Samples == r.Errors {
+			if _, err := fmt.Fprintf(w, "%-8s %7d %9s %-*s %9s %-*s %6d\n", r.Start.Format("15:04:05"), r.Samples, "-", reportBarWidth, "", "-", reportBarWidth, "", r.Errors); err != nil {
+				return err
+			}
+			continue
+		}
+		p99 := float64(r.QueryP99) / float64(time.Millisecond)
+		_, err := fmt.Fprintf(w, "%-8s %7d %9.1f %-*s %9.2f %-*s %6d\n",
+			r.Start.Format("15:04:05"), r.Samples,
+			r.AvgConnections, reportBarWidth, bar(r.AvgConnections, maxConns),
+			p99, reportBarWidth, bar(float64(r.QueryP99), float64(maxP99)),
+			r.Errors)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bar renders v as a horizontal bar of up to reportBarWidth characters,
+// full at hi, to the nearest eighth of a character.
+func bar(v, hi float64) string {
+	if hi <= 0 || v <= 0 {
+		return ""
+	}
+	eighths := int(math.Round(v / hi * reportBarWidth * 8))
+	return strings.Repeat(string(barBlocks[8]), eighths/8) + strings.TrimSpace(string(barBlocks[eighths%8]))
+}
@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"image/color"
+	"log"
+	"sync"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// restartColor is the color of the server restart markers.
+var restartColor = color.RGBA{R: 120, G: 60, B: 160, A: 255}
+
+// restartTime returns when the server restarted between prev and cur, which
+// is when the uptime of cur began, or false if it did not restart. Failed
+// samples have no uptime and are never compared.
+func restartTime(prev, cur Measurement) (time.Time, bool) {
+	if prev.Uptime == 0 || cur.Uptime == 0 || cur.Uptime >= prev.Uptime {
+		return time.Time{}, false
+	}
+	// Uptime has a resolution of a second, so keep the marker within the
+	// gap between the two samples
+	at := cur.Timestamp.Add(-cur.Uptime)
+	if at.Before(prev.Timestamp) {
+		at = prev.Timestamp
+	}
+	return at, true
+}
+
+// restarts returns the times the server restarted during measurements, as
+// seconds since the first one.
+func restarts(measurements []Measurement) []float64 {
+	var xs []float64
+	var prev Measurement
+	for _, m := range measurements {
+		if m.Uptime == 0 {
+			continue
+		}
+		if at, ok := restartTime(prev, m); ok {
+			xs = append(xs, instantOffset(measurements, at).Seconds())
+		}
+		prev = m
+	}
+	return xs
+}
+
+// RestartDetector is a Sink that logs when Measurement.Uptime goes down,
+// i.e. the server restarted, as restarts explain sudden connection drops
+// and latency spikes.
+type RestartDetector struct {
+	mu   sync.Mutex
+	prev Measurement
+}
+
+func (d *RestartDetector) Write(m Measurement) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if m.Uptime == 0 {
+		return nil
+	}
+	if at, ok := restartTime(d.prev, m); ok {
+		log.Printf("Server restarted at about %s (uptime went from %s to %s)", at.Format("15:04:05"), d.prev.Uptime, m.Uptime)
+	}
+	d.prev = m
+	return nil
+}
+
+// marker draws a vertical line at X across the whole height of a subplot,
+// labelled at the top, for restarts and events. It has no data range, so it
+// does not stretch the Y axis.
+type marker struct {
+	X     float64
+	Label string
+	Color color.Color
+}
+
+func (r marker) Plot(c draw.Canvas, p *plot.Plot) {
+	trX, _ := p.Transforms(&c)
+	x := trX(r.X)
+	if x < c.Min.X || x > c.Max.X {
+		return
+	}
+	c.StrokeLine2(draw.LineStyle{
+		Color:  r.Color,
+		Width:  vg.Points(1.5),
+		Dashes: []vg.Length{vg.Points(2), vg.Points(2)},
+	}, x, c.Min.Y, x, c.Max.Y)
+
+	style := draw.TextStyle{
+		Color:   r.Color,
+		Font:    p.Title.TextStyle.Font,
+		XAlign:  draw.XLeft,
+		YAlign:  draw.YTop,
+		Handler: p.Title.TextStyle.Handler,
+	}
+	style.Font.Size = vg.Points(10)
+	c.FillText(style, vg.Point{X: x + vg.Points(3), Y: c.Max.Y - vg.Points(3)}, r.Label)
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rollup aggregates the measurements of one interval, see RollupSink.
+// Durations are in nanoseconds, and failed samples are only counted.
+type Rollup struct {
+	Start            time.Time     `json:"start"`
+	Interval         time.Duration `json:"interval_ns"`
+	Samples          int           `json:"samples"`
+	Failed           int           `json:"failed"`
+	ConnectionsMin   int           `json:"connections_min"`
+	ConnectionsAvg   float64       `json:"connections_avg"`
+	ConnectionsMax   int           `json:"connections_max"`
+	QueryDurationMin time.Duration `json:"query_duration_min_ns"`
+	QueryDurationAvg time.Duration `json:"query_duration_avg_ns"`
+	QueryDurationMax time.Duration `json:"query_duration_max_ns"`
+	// QueryDurationP99 is estimated with a Sketch.
+	QueryDurationP99 time.Duration `json:"query_duration_p99_ns"`
+}
+
+// RollupSink is a Sink that aggregates measurements into consecutive
+// intervals aligned to multiples of Interval, and calls OnRollup with each
+// as soon as a measurement falls past its end. It keeps no measurements,
+// only running aggregates, so its memory stays flat however long the run.
+type RollupSink struct {
+	Interval time.Duration
+	OnRollup func(Rollup)
+
+	mu          sync.Mutex
+	cur         *Rollup
+	durationSum time.Duration
+	duration    *Sketch
+}
+
+func (s *RollupSink) Write(m Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := m.Timestamp.Truncate(s.Interval)
+	if s.cur != nil && !start.Equal(s.cur.Start) {
+		s.emit()
+	}
+	if s.cur == nil {
+		s.cur = &Rollup{Start: start, Interval: s.Interval}
+		s.durationSum = 0
+		s.duration = NewSketch(DefaultSketchAlpha)
+	}
+	r := s.cur
+	r.Samples++
+	if m.Failed {
+		r.Failed++
+		return nil
+	}
+	if ok := r.Samples - r.Failed; ok == 1 {
+		r.ConnectionsMin, r.ConnectionsMax = m.Connections, m.Connections
+		r.QueryDurationMin, r.QueryDurationMax = m.QueryDuration, m.QueryDuration
+	}
+	r.ConnectionsMin = min(r.ConnectionsMin, m.Connections)
+	r.ConnectionsMax = max(r.ConnectionsMax, m.Connections)
+	r.ConnectionsAvg += float64(m.Connections)
+	r.QueryDurationMin = min(r.QueryDurationMin, m.QueryDuration)
+	r.QueryDurationMax = max(r.QueryDurationMax, m.QueryDuration)
+	s.durationSum += m.QueryDuration
+	s.duration.Add(float64(m.QueryDuration))
+	return nil
+}
+
+// Close emits the interval in progress, even though it is not over, as the
+// run is.
+func (s *RollupSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur != nil {
+		s.emit()
+	}
+	return nil
+}
+
+// emit finishes the current interval and passes it to OnRollup.
+func (s *RollupSink) emit() {
+	r := *s.cur
+	s.cur = nil
+	if ok := r.Samples - r.Failed; ok > 0 {
+		// ConnectionsAvg held the sum so far
+		r.ConnectionsAvg /= float64(ok)
+		r.QueryDurationAvg = s.durationSum / time.Duration(ok)
+		r.QueryDurationP99 = time.Duration(s.duration.Quantile(0.99))
+	}
+	s.OnRollup(r)
+}
+
+// rollupCSVHeader is the header row of RollupCSVWriter.
+var rollupCSVHeader = []string{
+	"start", "interval_ns", "samples", "failed",
+	"connections_min", "connections_avg", "connections_max",
+	"query_duration_min_ns", "query_duration_avg_ns", "query_duration_max_ns", "query_duration_p99_ns",
+}
+
+// RollupCSVWriter writes rollups as CSV rows, flushing each as it comes. The
+// header row is written with the first rollup unless the output already
+// has one, e.g. when appending to the file of a previous run.
+type RollupCSVWriter struct {
+	cw     *csv.Writer
+	header bool
+}
+
+// NewRollupCSVWriter returns a RollupCSVWriter writing to w. Pass
+// hasHeader if w already starts with the header row.
+func NewRollupCSVWriter(w io.Writer, hasHeader bool) *RollupCSVWriter {
+	return &RollupCSVWriter{cw: csv.NewWriter(w), header: hasHeader}
+}
+
+func (w *RollupCSVWriter) Write(r Rollup) error {
+	if !w.header {
+		w.cw.Write(rollupCSVHeader)
+		w.header = true
+	}
+	w.cw.Write([]string{
+		r.Start.Format(time.RFC3339Nano),
+		strconv.FormatInt(int64(r.Interval), 10),
+		strconv.Itoa(r.Samples),
+		strconv.Itoa(r.Failed),
+		strconv.Itoa(r.ConnectionsMin),
+		strconv.FormatFloat(r.ConnectionsAvg, 'f', 2, 64),
+		strconv.Itoa(r.ConnectionsMax),
+		strconv.FormatInt(int64(r.QueryDurationMin), 10),
+		strconv.FormatInt(int64(r.QueryDurationAvg), 10),
+		strconv.FormatInt(int64(r.QueryDurationMax), 10),
+		strconv.FormatInt(int64(r.QueryDurationP99), 10),
+	})
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// WriteRollupMetrics writes r, the latest rollup, as Prometheus gauges in
+// the text exposition format, labelled with tags.
+func WriteRollupMetrics(w io.Writer, r Rollup, tags map[string]string) error {
+	bw := bufio.NewWriter(w)
+	labels := formatLabels(tags, "", "")
+	metric := func(name, help string, value float64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(bw, "%s%s %g\n", name, labels, value)
+	}
+	metric("clickhouse_monitor_rollup_start_timestamp_seconds", "Start of the latest rollup interval.", float64(r.Start.UnixMilli())/1000)
+	metric("clickhouse_monitor_rollup_samples", "Samples in the latest rollup interval, including failed ones.", float64(r.Samples))
+	metric("clickhouse_monitor_rollup_failed_samples", "Failed samples in the latest rollup interval.", float64(r.Failed))
+	metric("clickhouse_monitor_rollup_connections_min", "Minimum connections over the latest rollup interval.", float64(r.ConnectionsMin))
+	metric("clickhouse_monitor_rollup_connections_avg", "Average connections over the latest rollup interval.", r.ConnectionsAvg)
+	metric("clickhouse_monitor_rollup_connections_max", "Maximum connections over the latest rollup interval.", float64(r.ConnectionsMax))
+	metric("clickhouse_monitor_rollup_query_duration_min_seconds", "Minimum query duration over the latest rollup interval.", r.QueryDurationMin.Seconds())
+	metric("clickhouse_monitor_rollup_query_duration_avg_seconds", "Average query duration over the latest rollup interval.", r.QueryDurationAvg.Seconds())
+	metric("clickhouse_monitor_rollup_query_duration_max_seconds", "Maximum query duration over the latest rollup interval.", r.QueryDurationMax.Seconds())
+	metric("clickhouse_monitor_rollup_query_duration_p99_seconds", "Estimated p99 query duration over the latest rollup interval.", r.QueryDurationP99.Seconds())
+	return bw.Flush()
+}
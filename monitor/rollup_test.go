@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupSink(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	tests := []struct {
+		name         string
+		measurements []Measurement
+		want         []Rollup
+	}{
+		{"empty", nil, nil},
+		{
+			"one interval",
+			[]Measurement{
+				{Timestamp: at(1), Connections: 2, QueryDuration: 10 * time.Millisecond},
+				{Timestamp: at(2), Connections: 6, QueryDuration: 30 * time.Millisecond},
+			},
+			[]Rollup{{
+				Start: start, Interval: time.Minute, Samples: 2,
+				ConnectionsMin: 2, ConnectionsAvg: 4, ConnectionsMax: 6,
+				QueryDurationMin: 10 * time.Millisecond, QueryDurationAvg: 20 * time.Millisecond, QueryDurationMax: 30 * time.Millisecond,
+			}},
+		},
+		{
+			"failed samples are only counted",
+			[]Measurement{
+				{Timestamp: at(1), Failed: true},
+				{Timestamp: at(2), Connections: 3, QueryDuration: time.Millisecond},
+				{Timestamp: at(3), Failed: true, Paused: true},
+			},
+			[]Rollup{{
+				Start: start, Interval: time.Minute, Samples: 3, Failed: 2,
+				ConnectionsMin: 3, ConnectionsAvg: 3, ConnectionsMax: 3,
+				QueryDurationMin: time.Millisecond, QueryDurationAvg: time.Millisecond, QueryDurationMax: time.Millisecond,
+			}},
+		},
+		{
+			"only failed samples",
+			[]Measurement{{Timestamp: at(1), Failed: true}},
+			[]Rollup{{Start: start, Interval: time.Minute, Samples: 1, Failed: 1}},
+		},
+		{
+			"skipped interval",
+			[]Measurement{
+				{Timestamp: at(59), Connections: 1, QueryDuration: time.Millisecond},
+				{Timestamp: at(120), Connections: 5, QueryDuration: time.Millisecond},
+			},
+			[]Rollup{
+				{
+					Start: start, Interval: time.Minute, Samples: 1,
+					ConnectionsMin: 1, ConnectionsAvg: 1, ConnectionsMax: 1,
+					QueryDurationMin: time.Millisecond, QueryDurationAvg: time.Millisecond, QueryDurationMax: time.Millisecond,
+				},
+				{
+					Start: at(120), Interval: time.Minute, Samples: 1,
+					ConnectionsMin: 5, ConnectionsAvg: 5, ConnectionsMax: 5,
+					QueryDurationMin: time.Millisecond, QueryDurationAvg: time.Millisecond, QueryDurationMax: time.Millisecond,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Rollup
+			s := &RollupSink{Interval: time.Minute, OnRollup: func(r Rollup) { got = append(got, r) }}
+			for _, m := range tt.measurements {
+				s.Write(m)
+			}
+			s.Close()
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rollups, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, r := range got {
+				// The p99 is an estimate, only checked to be in range
+				if p99 := r.QueryDurationP99; p99 > 0 && (p99 < r.QueryDurationMin*99/100 || p99 > r.QueryDurationMax*101/100) {
+					t.Errorf("rollup %d: QueryDurationP99 = %s, want within [%s, %s]", i, p99, r.QueryDurationMin, r.QueryDurationMax)
+				}
+				r.QueryDurationP99 = 0
+				if r != tt.want[i] {
+					t.Errorf("rollup %d = %+v, want %+v", i, r, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Schema lists what a server can be monitored with: the names in its
+// system.metrics, system.events and system.asynchronous_metrics.
+type Schema struct {
+	Version string
+	Metrics []string
+	// Events only lists the counters incremented since the server started,
+	// as system.events omits the others.
+	Events              []string
+	AsynchronousMetrics []string
+}
+
+// ReadSchema reads the server version and the metric names available in
+// systemDB (DefaultSystemDB if empty), sorted.
+func ReadSchema(ctx context.Context, conn driver.Conn, systemDB string) (Schema, error) {
+	var s Schema
+	if err := conn.QueryRow(ctx, "SELECT version();").Scan(&s.Version); err != nil {
+		return Schema{}, err
+	}
+	for _, list := range []struct {
+		table, column string
+		names         *[]string
+	}{
+		{"metrics", "metric", &s.Metrics},
+		{"events", "event", &s.Events},
+		{"asynchronous_metrics", "metric", &s.AsynchronousMetrics},
+	} {
+		names, err := readNames(ctx, conn, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s;", list.column, systemTable(systemDB, list.table), list.column))
+		if err != nil {
+			return Schema{}, fmt.Errorf("reading %s: %v", list.table, err)
+		}
+		*list.names = names
+	}
+	return s, nil
+}
+
+func readNames(ctx context.Context, conn driver.Conn, query string) ([]string, error) {
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Series is a query returning a single number, collected on every sample
+// into Measurement.Metrics under Name, see Options.Series.
+type Series struct {
+	Name  string
+	Query string
+}
+
+// step is the name the outcome of the query of s is reported under.
+func (s Series) step() string {
+	return "series " + s.Name
+}
+
+// subquery returns the query of s without its trailing semicolon, so that it
+// can be nested in another query.
+func (s Series) subquery() string {
+	return strings.TrimSuffix(strings.TrimSpace(s.Query), ";")
+}
+
+// ValidateNames checks that profileEvents and the names of series are all
+// distinct and that no series is named like one of the values of
+// Measurement.Values, where they would overwrite each other, e.g. in a
+// ClickHouseSource, and share a legend.
+func ValidateNames(profileEvents []string, series []Series) error {
+	seen := map[string]bool{}
+	for _, event := range profileEvents {
+		if seen[event] {
+			return fmt.Errorf("ProfileEvent %s is given twice", event)
+		}
+		seen[event] = true
+	}
+	builtin, optional := Measurement{}.builtinValues(Options{})
+	for _, s := range series {
+		_, isBuiltin := builtin[s.Name]
+		_, isOptional := optional[s.Name]
+		if isBuiltin || isOptional {
+			return fmt.Errorf("series %q has the name of a built-in value", s.Name)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("series %q has the name of a ProfileEvent or another series", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// CheckSeries returns an error unless the query of s runs and returns
+// exactly one row of one numeric column, or NULL.
+func CheckSeries(ctx context.Context, conn driver.Conn, s Series) error {
+	rows, err := conn.Query(ctx, s.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if columns := rows.ColumnTypes(); len(columns) != 1 {
+		return fmt.Errorf("the query must return a single column, got %d", len(columns))
+	}
+	n := 0
+	for rows.Next() {
+		var value number
+		if err := rows.Scan(&value); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("the query must return a single row, got %d", n)
+	}
+	return nil
+}
+
+// series returns the value of each of Options.Series that is not NULL,
+// keyed by name. They are collected in a single query of scalar subqueries,
+// and only if that fails one by one, so that a failing series is reported
+// on its own and leaves a gap without losing the others.
+func (s *ClickHouseSource) series(ctx context.Context, report func(name string, err error)) map[string]float64 {
+	subqueries := make([]string, len(s.opts.Series))
+	values := make([]number, len(s.opts.Series))
+	dest := make([]any, len(s.opts.Series))
+	for i, series := range s.opts.Series {
+		subqueries[i] = "(" + series.subquery() + ")"
+		dest[i] = &values[i]
+	}
+	err := s.conn.QueryRow(s.queryContext(ctx), "SELECT "+strings.Join(subqueries, ", ")+";").Scan(dest...)
+	for i, series := range s.opts.Series {
+		if err != nil {
+			values[i] = number{}
+			report(series.step(), s.conn.QueryRow(s.queryContext(ctx), series.Query).Scan(&values[i]))
+		} else {
+			report(series.step(), nil)
+		}
+	}
+
+	metrics := make(map[string]float64, len(s.opts.Series))
+	for i, series := range s.opts.Series {
+		if values[i].valid {
+			metrics[series.Name] = values[i].float
+		}
+	}
+	return metrics
+}
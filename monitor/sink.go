@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// Sink consumes measurements as they are collected, e.g. to store them or
+// export them elsewhere.
+type Sink interface {
+	Write(Measurement) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(Measurement) error
+
+func (f SinkFunc) Write(m Measurement) error {
+	return f(m)
+}
+
+// Dispatch delivers every measurement received on in to each sink in turn,
+// until in is closed. A sink error is logged and doesn't stop delivery to the
+// remaining sinks. A slow sink holds up the rest, so the collector's buffer
+// fills up and it logs the backpressure.
+//
+// Once in is closed and drained, sinks implementing io.Closer are closed in
+// order, so that exporters have flushed everything when Dispatch returns.
+func Dispatch(in <-chan Measurement, sinks ...Sink) {
+	for m := range in {
+		for _, sink := range sinks {
+			if err := sink.Write(m); err != nil {
+				log.Printf("Error writing measurement to sink: %v", err)
+			}
+		}
+	}
+
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Error closing sink: %v", err)
+			}
+		}
+	}
+}
+
+// Recorder is a Sink that keeps every measurement in memory.
+type Recorder struct {
+	// CollapseFlat keeps only the first and the last of each run of
+	// consecutive measurements with the same values, see flat, so that
+	// long idle periods take two samples rather than thousands while
+	// charting the same lines, except for the query duration, which is
+	// lost within each run.
+	CollapseFlat bool
+
+	mu           sync.Mutex
+	measurements []Measurement
+}
+
+func (r *Recorder) Write(m Measurement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.measurements); r.CollapseFlat && n >= 2 && flat(r.measurements[n-2], r.measurements[n-1]) && flat(r.measurements[n-1], m) {
+		// Extend the run to m, dropping its previous last measurement
+		r.measurements[n-1] = m
+		return nil
+	}
+	r.measurements = append(r.measurements, m)
+	return nil
+}
+
+// Measurements returns a copy of the measurements recorded so far.
+func (r *Recorder) Measurements() []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Measurement(nil), r.measurements...)
+}
+
+// Drain returns the measurements recorded so far and forgets them, so that
+// a long-lived recorder can be emptied in chunks without losing any.
+func (r *Recorder) Drain() []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	measurements := r.measurements
+	r.measurements = nil
+	return measurements
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"maps"
+	"math"
+	"slices"
+)
+
+// DefaultSketchAlpha is the relative accuracy of the quantile sketches used
+// for summary statistics.
+const DefaultSketchAlpha = 0.01
+
+// Sketch is a streaming quantile estimator in the style of DDSketch. Values
+// are counted in logarithmically sized buckets, so any quantile is estimated
+// within a relative error of Alpha using memory that depends on the range of
+// the values, not on how many were added.
+type Sketch struct {
+	Alpha float64 `json:"alpha"`
+	Count uint64  `json:"count"`
+	// Zeros counts values that are not positive, which have no bucket.
+	Zeros uint64 `json:"zeros"`
+	// Buckets maps bucket index k, covering (γ^(k-1), γ^k] with
+	// γ = (1+Alpha)/(1-Alpha), to its count.
+	Buckets map[int]uint64 `json:"buckets"`
+}
+
+// NewSketch returns an empty Sketch with relative accuracy alpha, in (0, 1),
+// e.g. DefaultSketchAlpha.
+func NewSketch(alpha float64) *Sketch {
+	return &Sketch{Alpha: alpha, Buckets: map[int]uint64{}}
+}
+
+// gamma is the ratio between the bounds of each bucket.
+func (s *Sketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// Add counts v. Values that are not positive, NaN included, count as zero.
+func (s *Sketch) Add(v float64) {
+	s.Count++
+	if v <= 0 || math.IsNaN(v) {
+		s.Zeros++
+		return
+	}
+	s.Buckets[int(math.Ceil(math.Log(v)/math.Log(s.gamma())))]++
+}
+
+// Quantile returns the estimated q-quantile, for q in [0, 1], or NaN if the
+// sketch is empty.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.Count-1))
+	if rank < s.Zeros {
+		return 0
+	}
+	seen := s.Zeros
+	keys := make([]int, 0, len(s.Buckets))
+	for k := range s.Buckets {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		seen += s.Buckets[k]
+		if seen > rank {
+			// The midpoint of the bucket in relative terms
+			return 2 * math.Pow(s.gamma(), float64(k)) / (s.gamma() + 1)
+		}
+	}
+	return 2 * math.Pow(s.gamma(), float64(keys[len(keys)-1])) / (s.gamma() + 1)
+}
+
+// Clone returns an independent copy of s.
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	c.Buckets = maps.Clone(s.Buckets)
+	return &c
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		values []float64
+	}{
+		{"single value", []float64{42}},
+		{"uniform", func() []float64 {
+			v := make([]float64, 10000)
+			for i := range v {
+				v[i] = float64(i + 1)
+			}
+			return v
+		}()},
+		{"long tail", func() []float64 {
+			v := make([]float64, 10000)
+			for i := range v {
+				v[i] = math.Exp(r.NormFloat64() * 3)
+			}
+			return v
+		}()},
+		{"sub-millisecond", []float64{0.001, 0.002, 0.0005, 0.003}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSketch(DefaultSketchAlpha)
+			for _, v := range tt.values {
+				s.Add(v)
+			}
+			sorted := slices.Clone(tt.values)
+			slices.Sort(sorted)
+			for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 1} {
+				want := sorted[int(q*float64(len(sorted)-1))]
+				got := s.Quantile(q)
+				if math.Abs(got-want) > DefaultSketchAlpha*want {
+					t.Errorf("Quantile(%g) = %g, want %g within %g", q, got, want, DefaultSketchAlpha)
+				}
+			}
+		})
+	}
+}
+
+func TestSketchEdgeCases(t *testing.T) {
+	empty := NewSketch(DefaultSketchAlpha)
+	if got := empty.Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("empty Quantile(0.5) = %g, want NaN", got)
+	}
+
+	zeros := NewSketch(DefaultSketchAlpha)
+	for _, v := range []float64{0, -1, math.NaN()} {
+		zeros.Add(v)
+	}
+	if got := zeros.Quantile(1); got != 0 {
+		t.Errorf("Quantile(1) of values that are not positive = %g, want 0", got)
+	}
+
+	// A clone does not share its buckets
+	s := NewSketch(DefaultSketchAlpha)
+	s.Add(1)
+	c := s.Clone()
+	c.Add(1000)
+	if s.Count != 1 || s.Quantile(1) > 1+DefaultSketchAlpha {
+		t.Errorf("adding to a clone changed the original, Count = %d, Quantile(1) = %g", s.Count, s.Quantile(1))
+	}
+}
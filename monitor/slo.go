@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"image/color"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// addSLO draws slo as a threshold line and shades the area between it and
+// pts wherever pts exceeds it, so that violations stand out as red patches.
+// Gaps in pts, see finiteRuns, end a patch.
+func addSLO(p *plot.Plot, pts plotter.XYs, slo float64) error {
+	runs, _ := finiteRuns(pts)
+	var polygons []plotter.XYs
+	for _, run := range runs {
+		polygons = append(polygons, sloPolygons(run, slo)...)
+	}
+	for _, outline := range polygons {
+		shade, err := plotter.NewPolygon(outline)
+		if err != nil {
+			return err
+		}
+		shade.Color = color.NRGBA{R: 200, A: 60}
+		shade.LineStyle.Width = 0
+		p.Add(shade)
+	}
+	return addThreshold(p, pts, slo, "SLO")
+}
+
+// sloPolygons returns the outlines of the areas between pts and slo where
+// pts exceeds it.
+func sloPolygons(pts plotter.XYs, slo float64) []plotter.XYs {
+	var polygons []plotter.XYs
+	var above plotter.XYs
+	for i, pt := range pts {
+		if pt.Y > slo {
+			if len(above) == 0 {
+				above = append(above, plotter.XY{X: crossing(pts, i-1, slo), Y: slo})
+			}
+			above = append(above, pt)
+			continue
+		}
+		if len(above) > 0 {
+			above = append(above, plotter.XY{X: crossing(pts, i-1, slo), Y: slo})
+			polygons = append(polygons, above)
+			above = nil
+		}
+	}
+	if len(above) > 0 {
+		polygons = append(polygons, append(above, plotter.XY{X: above[len(above)-1].X, Y: slo}))
+	}
+	return polygons
+}
+
+// crossing returns the X at which the segment from pts[i] to pts[i+1]
+// crosses y, or the X of pts[i+1] at the start of the series.
+func crossing(pts plotter.XYs, i int, y float64) float64 {
+	if i < 0 {
+		return pts[0].X
+	}
+	a, b := pts[i], pts[i+1]
+	if a.Y == b.Y {
+		return a.X
+	}
+	return a.X + (y-a.Y)/(b.Y-a.Y)*(b.X-a.X)
+}
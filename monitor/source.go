@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"gonum.org/v1/plot/plotter"
+)
+
+// MetricSource is something a Monitor can sample, e.g. a ClickHouseSource, a
+// Prometheus query or a second database. Collect returns the current value
+// of each of its metrics, keyed by name.
+type MetricSource interface {
+	Collect(ctx context.Context) (map[string]float64, error)
+}
+
+// NewWithSource returns a Monitor that samples source on every interval,
+// putting its values in Measurement.Metrics, so that the charts, exporters
+// and sinks work with any source. The options that select ClickHouse
+// queries, e.g. ProfileEvents or ServerAggregate, have no effect.
+func NewWithSource(source MetricSource, opts Options) *Monitor {
+	m := newMonitor(opts)
+	m.source = source
+	if clickhouse, ok := source.(*ClickHouseSource); ok {
+		m.clickhouse = clickhouse
+	}
+	return m
+}
+
+// collectSource takes a single measurement of the MetricSource, timing it
+// like the ClickHouse query, and reports its outcome as "metrics". An error
+// yields a failed measurement.
+func (m *Monitor) collectSource(ctx context.Context, report func(name string, err error)) Measurement {
+	start := time.Now()
+	metrics, err := m.source.Collect(ctx)
+	report("metrics", err)
+	if err != nil {
+		return failedMeasurement(start)
+	}
+	duration := time.Since(start)
+	return Measurement{
+		Timestamp:     start,
+		QueryDuration: duration,
+		RoundTrip:     duration,
+		Metrics:       metrics,
+	}
+}
+
+// metricSeries returns the points of the metric name of Measurement.Metrics.
+// Failed samples, which carry no metrics, are skipped over.
+func metricSeries(measurements []Measurement, name string) plotter.XYs {
+	var pts plotter.XYs
+	for i := range measurements {
+		if v, ok := measurements[i].Metrics[name]; ok {
+			pts = append(pts, plotter.XY{X: offset(&measurements[0], &measurements[i]).Seconds(), Y: v})
+		}
+	}
+	return pts
+}
+
+// Values returns the values of m keyed by name, with durations in
+// milliseconds and ProfileEvents and Metrics under their own names. The
+// optional values are only there if opts collects them.
+func (m Measurement) Values(opts Options) map[string]float64 {
+	values, optional := m.builtinValues(opts)
+	for name, v := range optional {
+		if v.collected {
+			values[name] = v.value
+		}
+	}
+	for name, v := range m.ProfileEvents {
+		values[name] = float64(v)
+	}
+	for name, v := range m.Metrics {
+		values[name] = v
+	}
+	return values
+}
+
+// optionalValue is one of the values of Measurement.Values that only some
+// Options collect.
+type optionalValue struct {
+	value     float64
+	collected bool
+}
+
+// builtinValues returns the values of m that Values always has and the
+// optional ones, with whether opts collects them, keyed by name, leaving
+// out ProfileEvents and Metrics.
+func (m Measurement) builtinValues(opts Options) (values map[string]float64, optional map[string]optionalValue) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	values = map[string]float64{
+		"connections":       float64(m.Connections),
+		"query_duration_ms": ms(m.QueryDuration),
+	}
+	optional = map[string]optionalValue{
+		"active_queries":              {float64(m.ActiveQueries), opts.ConnectionSource == ConnectionsBoth && !m.ActiveQueriesFailed},
+		"distinct_clients":            {float64(m.DistinctClients), opts.CountDistinctClients && !m.DistinctClientsFailed},
+		"query_p50_ms":                {ms(m.QueryP50), opts.QueryLogLatency && !m.Backfilled},
+		"query_p99_ms":                {ms(m.QueryP99), opts.QueryLogLatency && !m.Backfilled},
+		"table_rows":                  {float64(m.TableRows), opts.WatchTable != "" && !m.TableRowsFailed},
+		"dashboard_value":             {m.DashboardValue, opts.DashboardQuery != "" && !m.DashboardValueFailed},
+		"keeper_sessions":             {float64(m.KeeperSessions), opts.Keeper && !m.KeeperFailed},
+		"keeper_requests":             {float64(m.KeeperRequests), opts.Keeper && !m.KeeperFailed},
+		"queries_running":             {float64(m.QueriesRunning), opts.QueryQueue && !m.QueryQueueFailed},
+		"queries_waiting":             {float64(m.QueriesWaiting), opts.QueryQueue && !m.QueryQueueFailed},
+		"distributed_sends":           {float64(m.DistributedSends), opts.Distributed && !m.DistributedFailed},
+		"distributed_files_to_insert": {float64(m.DistributedFilesToInsert), opts.Distributed && !m.DistributedFailed},
+		"uptime_s":                    {m.Uptime.Seconds(), opts.Uptime && !m.Backfilled},
+	}
+	return values, optional
+}
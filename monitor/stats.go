@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// Summary holds statistics over a whole run.
+type Summary struct {
+	// RunID is the query_id prefix of the monitor's queries, see
+	// Options.RunID.
+	RunID string `json:"run_id,omitempty"`
+	// Tags identify the monitor instance that produced the summary.
+	Tags            map[string]string `json:"tags,omitempty"`
+	Samples         uint64            `json:"samples"`
+	PeakConnections int               `json:"peak_connections"`
+	// Query duration percentiles, in milliseconds, estimated from
+	// QueryDurationSketch. Failed samples are not included.
+	QueryDurationP50 float64 `json:"query_duration_p50_ms"`
+	QueryDurationP90 float64 `json:"query_duration_p90_ms"`
+	QueryDurationP99 float64 `json:"query_duration_p99_ms"`
+	// Exact minimum and mean query durations, in milliseconds.
+	QueryDurationMin float64 `json:"query_duration_min_ms"`
+	QueryDurationAvg float64 `json:"query_duration_avg_ms"`
+	// QueryDurationSketch is the quantile sketch of query durations in
+	// milliseconds, for computing further percentiles.
+	QueryDurationSketch *Sketch `json:"query_duration_sketch"`
+	// SLODuration and SLOViolationFraction, set if Stats.SLODuration is,
+	// give the query duration SLO in milliseconds and the fraction of
+	// samples that exceeded it. Failed samples are not included.
+	SLODuration          float64  `json:"slo_duration_ms,omitempty"`
+	SLOViolationFraction *float64 `json:"slo_violation_fraction,omitempty"`
+	// Comparison compares the run with a baseline run, if one was given.
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
+// Stats is a Sink that keeps running summary statistics in constant memory,
+// however long the run.
+type Stats struct {
+	// SLODuration, if positive, counts the samples whose query duration
+	// exceeds it. It must be set before the first Write.
+	SLODuration time.Duration
+
+	mu              sync.Mutex
+	samples         uint64
+	peakConnections int
+	duration        *Sketch
+	durationMin     float64
+	durationSum     float64
+	sloViolations   uint64
+}
+
+func NewStats() *Stats {
+	return &Stats{duration: NewSketch(DefaultSketchAlpha)}
+}
+
+func (s *Stats) Write(m Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples++
+	s.peakConnections = max(s.peakConnections, m.Connections)
+	if m.QueryDuration > 0 {
+		ms := float64(m.QueryDuration.Microseconds()) / 1000
+		if s.duration.Count == 0 || ms < s.durationMin {
+			s.durationMin = ms
+		}
+		s.durationSum += ms
+		s.duration.Add(ms)
+		if s.SLODuration > 0 && m.QueryDuration > s.SLODuration {
+			s.sloViolations++
+		}
+	}
+	return nil
+}
+
+// Summary returns the statistics of the measurements written so far.
+func (s *Stats) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := Summary{
+		Samples:             s.samples,
+		PeakConnections:     s.peakConnections,
+		QueryDurationSketch: s.duration.Clone(),
+	}
+	if s.duration.Count > 0 {
+		summary.QueryDurationP50 = s.duration.Quantile(0.5)
+		summary.QueryDurationP90 = s.duration.Quantile(0.9)
+		summary.QueryDurationP99 = s.duration.Quantile(0.99)
+		summary.QueryDurationMin = s.durationMin
+		summary.QueryDurationAvg = s.durationSum / float64(s.duration.Count)
+	}
+	if s.SLODuration > 0 {
+		summary.SLODuration = float64(s.SLODuration.Microseconds()) / 1000
+		fraction := 0.0
+		if s.duration.Count > 0 {
+			fraction = float64(s.sloViolations) / float64(s.duration.Count)
+		}
+		summary.SLOViolationFraction = &fraction
+	}
+	return summary
+}
@@ -0,0 +1,44 @@
+package monitor
+
+// thin returns at most n of the measurements, to keep charts of very long
+// runs fast to render. Each of n/2 consecutive buckets keeps, in order, its
+// sample with the most connections and the one with the longest query
+// duration, so that the peaks of both show, or one sample if they are the
+// same. A failed sample, if the bucket has one, takes the place of the
+// connections peak so that outages still show. With n of 1 there is a
+// single bucket, which keeps only that one. Zero n keeps every measurement.
+func thin(measurements []Measurement, n int) []Measurement {
+	if n <= 0 || len(measurements) <= n {
+		return measurements
+	}
+	buckets := n / 2
+	if n < 2 {
+		buckets = 1
+	}
+	out := make([]Measurement, 0, n)
+	for i := 0; i < buckets; i++ {
+		from, to := i*len(measurements)/buckets, (i+1)*len(measurements)/buckets
+		connections, duration := from, from
+		for j := from + 1; j < to; j++ {
+			m := measurements[j]
+			switch {
+			case measurements[connections].Failed:
+			case m.Failed || m.Connections > measurements[connections].Connections:
+				connections = j
+			}
+			if !m.Failed && !m.Backfilled && (measurements[duration].Failed || measurements[duration].Backfilled || m.QueryDuration > measurements[duration].QueryDuration) {
+				duration = j
+			}
+		}
+		first, second := min(connections, duration), max(connections, duration)
+		if n < 2 {
+			out = append(out, measurements[connections])
+			continue
+		}
+		out = append(out, measurements[first])
+		if second != first {
+			out = append(out, measurements[second])
+		}
+	}
+	return out[:min(len(out), n)]
+}
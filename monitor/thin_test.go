@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThin(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	measurements := func(connections ...int) []Measurement {
+		out := make([]Measurement, len(connections))
+		for i, c := range connections {
+			out[i] = Measurement{Timestamp: start.Add(time.Duration(i) * time.Second), Connections: c, QueryDuration: time.Duration(len(connections)-i) * time.Millisecond}
+		}
+		return out
+	}
+	tests := []struct {
+		name         string
+		measurements []Measurement
+		n            int
+		want         int
+	}{
+		{"zero n keeps all", measurements(1, 2, 3), 0, 3},
+		{"shorter than n", measurements(1, 2), 3, 2},
+		{"as long as n", measurements(1, 2, 3), 3, 3},
+		{"empty", nil, 2, 0},
+		{"one", measurements(1, 5, 2, 4), 1, 1},
+		{"two", measurements(1, 5, 2, 4, 3), 2, 2},
+		{"three", measurements(1, 5, 2, 4, 3), 3, 2},
+		{"odd n", measurements(1, 5, 2, 4, 3, 6, 0, 7), 5, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := thin(tt.measurements, tt.n)
+			if len(got) != tt.want {
+				t.Errorf("thin(%d samples, %d) kept %d, want %d", len(tt.measurements), tt.n, len(got), tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if !got[i].Timestamp.After(got[i-1].Timestamp) {
+					t.Errorf("thin(%d samples, %d) is out of order at %d", len(tt.measurements), tt.n, i)
+				}
+			}
+		})
+	}
+
+	// A single bucket keeps the connections peak
+	if got := thin(measurements(1, 5, 2, 4), 1); got[0].Connections != 5 {
+		t.Errorf("thin(n=1) kept %d connections, want the peak of 5", got[0].Connections)
+	}
+}
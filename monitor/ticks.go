@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"math"
+	"strconv"
+
+	"gonum.org/v1/plot"
+)
+
+// niceSteps are the candidate intervals, in seconds, between time axis ticks.
+var niceSteps = []float64{
+	0.1, 0.2, 0.5, 1, 2, 5, 10, 15, 30,
+	60, 120, 300, 600, 900, 1800,
+	3600, 2 * 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600,
+}
+
+// timeTicker places at most max labelled ticks on a time axis in seconds, at
+// a round interval such as 30s, 5m or 1h.
+type timeTicker struct {
+	max int
+}
+
+func (t timeTicker) Ticks(min, max float64) []plot.Tick {
+	step := niceSteps[len(niceSteps)-1]
+	for _, s := range niceSteps {
+		if (max-min)/s <= float64(t.max-1) {
+			step = s
+			break
+		}
+	}
+
+	var ticks []plot.Tick
+	for i := math.Ceil(min / step); i*step <= max; i++ {
+		v := i * step
+		// Round away float noise such as 0.30000000000000004
+		label := strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+		ticks = append(ticks, plot.Tick{Value: v, Label: label})
+		// An unlabelled minor tick halfway to the next one
+		if mid := v + step/2; mid <= max {
+			ticks = append(ticks, plot.Tick{Value: mid})
+		}
+	}
+	return ticks
+}
+
+// AxisUnit selects how large values are labelled on a Y axis.
+type AxisUnit string
+
+const (
+	// AxisSI abbreviates thousands as K, millions as M and so on.
+	AxisSI AxisUnit = "si"
+	// AxisBytes abbreviates powers of 1024 as KiB, MiB and so on.
+	AxisBytes AxisUnit = "bytes"
+	// AxisPlain keeps the raw values.
+	AxisPlain AxisUnit = "plain"
+)
+
+// unitTicker relabels the default ticks with the suffixes of unit, e.g.
+// 12M instead of 12000000.
+type unitTicker struct {
+	unit AxisUnit
+}
+
+func (t unitTicker) Ticks(min, max float64) []plot.Tick {
+	ticks := plot.DefaultTicks{}.Ticks(min, max)
+	if t.unit == AxisPlain {
+		return ticks
+	}
+	base, suffixes := 1000.0, []string{"", "K", "M", "G", "T"}
+	if t.unit == AxisBytes {
+		base, suffixes = 1024, []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	}
+	for i, tick := range ticks {
+		if tick.Label == "" {
+			continue
+		}
+		v, exp := tick.Value, 0
+		for math.Abs(v) >= base && exp < len(suffixes)-1 {
+			v /= base
+			exp++
+		}
+		if exp > 0 || t.unit == AxisBytes {
+			ticks[i].Label = strconv.FormatFloat(v, 'g', 4, 64) + suffixes[exp]
+		}
+	}
+	return ticks
+}
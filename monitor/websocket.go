@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsClientBuffer is how many measurements may queue up for a WebSocket
+// client before new ones are dropped for it.
+const wsClientBuffer = 16
+
+// WebSocketSink is a Sink that pushes every measurement as JSON to all
+// connected WebSocket clients. Serve Handler on an HTTP server to accept
+// clients. A slow client misses measurements rather than blocking the
+// collector.
+type WebSocketSink struct {
+	tags    map[string]string
+	mu      sync.Mutex
+	clients map[chan Measurement]struct{}
+	closed  bool
+}
+
+// NewWebSocketSink returns a WebSocketSink whose messages carry tags.
+func NewWebSocketSink(tags map[string]string) *WebSocketSink {
+	return &WebSocketSink{tags: tags, clients: map[chan Measurement]struct{}{}}
+}
+
+func (s *WebSocketSink) Write(m Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	for client := range s.clients {
+		select {
+		case client <- m:
+		default:
+			log.Printf("WebSocket client too slow, dropping measurement")
+		}
+	}
+	return nil
+}
+
+// Close disconnects every client once it has been sent the measurements
+// queued for it.
+func (s *WebSocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for client := range s.clients {
+		close(client)
+	}
+	return nil
+}
+
+// Handler returns the WebSocket handler that streams measurements to each
+// client until it disconnects. Clients from any origin are accepted, so that
+// both browsers and tools like websocat can connect.
+func (s *WebSocketSink) Handler() http.Handler {
+	return websocket.Server{Handler: s.serve}
+}
+
+func (s *WebSocketSink) serve(ws *websocket.Conn) {
+	defer ws.Close()
+
+	client := make(chan Measurement, wsClientBuffer)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	// Clients don't send anything, so a read only returns on disconnect
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case m, ok := <-client:
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(ws, taggedMeasurement{Measurement: m, Tags: s.tags}); err != nil {
+				return
+			}
+		}
+	}
+}
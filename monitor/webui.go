@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//go:embed webui.html
+var webUIPage []byte
+
+// WebUIHandler returns an HTTP handler serving a self-contained live chart
+// page at / and the JSON it polls:
+//
+//   - /latest, the latest measurement, or 204 No Content before the first
+//   - /measurements, every measurement, or with ?since=<RFC 3339 time>
+//     only those after it
+//
+// Measurements are read from recorder on every request.
+func WebUIHandler(recorder *Recorder) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webUIPage)
+	})
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		measurements := recorder.Measurements()
+		if len(measurements) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, measurements[len(measurements)-1])
+	})
+	mux.HandleFunc("/measurements", func(w http.ResponseWriter, r *http.Request) {
+		measurements := recorder.Measurements()
+		if since := r.URL.Query().Get("since"); since != "" {
+			t, err := time.Parse(time.RFC3339Nano, since)
+			if err != nil {
+				http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			i := len(measurements)
+			for i > 0 && measurements[i-1].Timestamp.After(t) {
+				i--
+			}
+			measurements = measurements[i:]
+		}
+		if measurements == nil {
+			measurements = []Measurement{}
+		}
+		writeJSON(w, measurements)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Zoom restricts the chart to a window of the run, as offsets from the first
+// sample. The zero Zoom plots the whole run.
+type Zoom struct {
+	From time.Duration
+	// To is the end of the window. Zero means the end of the run.
+	To time.Duration
+}
+
+// ParseZoom parses a window such as "120s-180s", or "120s-" for everything
+// after 120s.
+func ParseZoom(s string) (Zoom, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Zoom{}, fmt.Errorf("expected FROM-TO, e.g. 120s-180s")
+	}
+
+	var z Zoom
+	var err error
+	if z.From, err = time.ParseDuration(from); err != nil {
+		return Zoom{}, err
+	}
+	if to != "" {
+		if z.To, err = time.ParseDuration(to); err != nil {
+			return Zoom{}, err
+		}
+		if z.To <= z.From {
+			return Zoom{}, fmt.Errorf("end %s is not after start %s", z.To, z.From)
+		}
+	}
+	return z, nil
+}
+
+// apply returns the measurements that fall within the window.
+func (z Zoom) apply(measurements []Measurement) ([]Measurement, error) {
+	if z == (Zoom{}) || len(measurements) == 0 {
+		return measurements, nil
+	}
+
+	start := &measurements[0]
+	if last := offset(start, &measurements[len(measurements)-1]); z.From > last {
+		return nil, fmt.Errorf("zoom window starts at %s but the run only lasted %s", z.From, last.Round(time.Second))
+	}
+
+	var out []Measurement
+	for i := range measurements {
+		at := offset(start, &measurements[i])
+		if at >= z.From && (z.To == 0 || at <= z.To) {
+			out = append(out, measurements[i])
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no samples in zoom window %s-%s", z.From, z.To)
+	}
+	return out, nil
+}
+
+// tail returns the measurements within d of the last one, or all of them if
+// d is zero. Like Zoom, it goes by offset rather than by the wall clock, so
+// that a clock adjustment during the run does not change the window.
+func tail(measurements []Measurement, d time.Duration) []Measurement {
+	if d <= 0 || len(measurements) == 0 {
+		return measurements
+	}
+	start := &measurements[0]
+	since := offset(start, &measurements[len(measurements)-1]) - d
+	i := sort.Search(len(measurements), func(i int) bool { return offset(start, &measurements[i]) >= since })
+	return measurements[i:]
+}
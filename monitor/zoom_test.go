@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseZoom(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Zoom
+		ok   bool
+	}{
+		{"120s-180s", Zoom{From: 120 * time.Second, To: 180 * time.Second}, true},
+		{"2m-", Zoom{From: 2 * time.Minute}, true},
+		{"0s-1m", Zoom{To: time.Minute}, true},
+		{"120s", Zoom{}, false},
+		{"-180s", Zoom{}, false},
+		{"180s-120s", Zoom{}, false},
+		{"1m-1m", Zoom{}, false},
+		{"1m-soon", Zoom{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseZoom(tt.in)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("ParseZoom(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("ParseZoom(%q) = %+v, want an error", tt.in, got)
+		}
+	}
+}
+
+func TestZoomApply(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	measurements := make([]Measurement, 5)
+	for i := range measurements {
+		measurements[i] = Measurement{Timestamp: start.Add(time.Duration(i) * time.Minute), Connections: i}
+	}
+	// The wall clock stepped back an hour before the last sample, which
+	// Elapsed does not
+	clockStep := make([]Measurement, len(measurements))
+	for i, m := range measurements {
+		m.Elapsed = time.Duration(i+1) * time.Minute
+		clockStep[i] = m
+	}
+	clockStep[4].Timestamp = clockStep[4].Timestamp.Add(-time.Hour)
+
+	tests := []struct {
+		name         string
+		zoom         Zoom
+		measurements []Measurement
+		want         []int
+		ok           bool
+	}{
+		{"whole run", Zoom{}, measurements, []int{0, 1, 2, 3, 4}, true},
+		{"empty", Zoom{From: time.Minute}, nil, nil, true},
+		{"window", Zoom{From: time.Minute, To: 3 * time.Minute}, measurements, []int{1, 2, 3}, true},
+		{"open end", Zoom{From: 3 * time.Minute}, measurements, []int{3, 4}, true},
+		{"after the run", Zoom{From: time.Hour}, measurements, nil, false},
+		{"between samples", Zoom{From: 90 * time.Second, To: 100 * time.Second}, measurements, nil, false},
+		{"by elapsed time", Zoom{From: 3 * time.Minute}, clockStep, []int{3, 4}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.zoom.apply(tt.measurements)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("apply = %d samples, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("apply kept %d samples, want %v", len(got), tt.want)
+			}
+			for i, m := range got {
+				if m.Connections != tt.want[i] {
+					t.Errorf("sample %d has %d connections, want %d", i, m.Connections, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTail(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	measurements := make([]Measurement, 5)
+	for i := range measurements {
+		measurements[i] = Measurement{Timestamp: start.Add(time.Duration(i) * time.Minute), Elapsed: time.Duration(i+1) * time.Minute, Connections: i}
+	}
+	// The wall clock stepped back an hour before the last sample
+	measurements[4].Timestamp = measurements[4].Timestamp.Add(-time.Hour)
+
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 5},
+		{time.Minute, 2},
+		{150 * time.Second, 3},
+		{time.Hour, 5},
+	}
+	for _, tt := range tests {
+		if got := tail(measurements, tt.d); len(got) != tt.want {
+			t.Errorf("tail(%s) kept %d samples, want %d", tt.d, len(got), tt.want)
+		}
+	}
+	if got := tail(nil, time.Minute); len(got) != 0 {
+		t.Errorf("tail of no samples kept %d", len(got))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// presetFlag is a flag value a preset sets, once per value of a repeatable
+// flag.
+type presetFlag struct {
+	name, value string
+}
+
+// preset is a named configuration of -preset.
+type preset struct {
+	// description is shown by -list-presets.
+	description string
+	flags       []presetFlag
+}
+
+// presets are the named configurations of -preset, curated dashboards for
+// users who have not learnt the flags yet. Adding one here is enough for
+// -preset and -list-presets to offer it.
+var presets = map[string]preset{
+	"golden": {
+		description: "traffic, latency, saturation and background work at a glance",
+		flags: []presetFlag{
+			{"profile-event", "Query"},
+			{"profile-event", "Merge"},
+			{"query-log-latency", "true"},
+			{"dashboard", "Memory (tracked)"},
+			{"availability", "true"},
+		},
+	},
+	"ingestion": {
+		description: "insert throughput and the parts it creates",
+		flags: []presetFlag{
+			{"profile-event", "InsertQuery"},
+			{"profile-event", "InsertedRows"},
+			{"profile-event", "DelayedInserts"},
+			{"profile-event", "RejectedInserts"},
+			{"io-throughput", "true"},
+			{"dashboard", "Max Parts For Partition"},
+		},
+	},
+	"replication": {
+		description: "Keeper load and the parts replicas fetch and merge",
+		flags: []presetFlag{
+			{"keeper", "true"},
+			{"profile-event", "ReplicatedPartFetches"},
+			{"profile-event", "ReplicatedPartFailedFetches"},
+			{"profile-event", "ReplicatedPartMerges"},
+			{"annotate-restarts", "true"},
+		},
+	},
+}
+
+// presetNames returns the names of the presets, sorted.
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset sets the flags of the preset name that were not set on the
+// command line or from the environment, so that both take precedence over
+// the preset, which takes precedence over the defaults.
+func applyPreset(fs *flag.FlagSet, name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown -preset %q: must be one of %s", name, strings.Join(presetNames(), ", "))
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, p := range preset.flags {
+		if given[p.name] {
+			continue
+		}
+		if err := fs.Set(p.name, p.value); err != nil {
+			return fmt.Errorf("-preset %s: invalid -%s %q: %v", name, p.name, p.value, err)
+		}
+	}
+	return nil
+}
+
+// String returns p as it would be given on the command line, e.g.
+// -dashboard "Memory (tracked)", or just -keeper for a boolean.
+func (p presetFlag) String() string {
+	switch {
+	case p.value == "true":
+		return "-" + p.name
+	case strings.ContainsAny(p.value, " \t\"'"):
+		return "-" + p.name + " " + strconv.Quote(p.value)
+	}
+	return "-" + p.name + " " + p.value
+}
+
+// writePresets writes every preset for -list-presets, with its description
+// and the flags it expands into.
+func writePresets(w io.Writer) error {
+	for _, name := range presetNames() {
+		preset := presets[name]
+		if _, err := fmt.Fprintf(w, "%s: %s\n", name, preset.description); err != nil {
+			return err
+		}
+		for _, p := range preset.flags {
+			if _, err := fmt.Fprintf(w, "  %s\n", p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
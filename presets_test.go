@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+)
+
+func TestApplyPreset(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	keeper := fs.Bool("keeper", false, "")
+	annotateRestarts := fs.Bool("annotate-restarts", false, "")
+	var profileEvents listFlag
+	fs.Var(&profileEvents, "profile-event", "")
+	if err := fs.Parse([]string{"-annotate-restarts=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPreset(fs, "replication"); err != nil {
+		t.Fatalf("applyPreset: %v", err)
+	}
+	if *annotateRestarts {
+		t.Errorf("-annotate-restarts = true, want the false given on the command line")
+	}
+	if !*keeper {
+		t.Errorf("-keeper = false, want true from the preset")
+	}
+	want := listFlag{"ReplicatedPartFetches", "ReplicatedPartFailedFetches", "ReplicatedPartMerges"}
+	if !slices.Equal(profileEvents, want) {
+		t.Errorf("-profile-event = %v, want %v", profileEvents, want)
+	}
+}
+
+func TestApplyPresetRepeatable(t *testing.T) {
+	// A repeatable flag given on the command line replaces all of the
+	// preset's values rather than adding to them
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("keeper", false, "")
+	fs.Bool("annotate-restarts", false, "")
+	var profileEvents listFlag
+	fs.Var(&profileEvents, "profile-event", "")
+	if err := fs.Parse([]string{"-profile-event", "Query"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPreset(fs, "replication"); err != nil {
+		t.Fatalf("applyPreset: %v", err)
+	}
+	if want := (listFlag{"Query"}); !slices.Equal(profileEvents, want) {
+		t.Errorf("-profile-event = %v, want %v", profileEvents, want)
+	}
+
+	if err := applyPreset(fs, "nonexistent"); err == nil {
+		t.Errorf("applyPreset of an unknown preset = nil, want an error")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// promptDSN asks on the terminal for the host, user and password of the
+// server, reading the password without echoing it, so that it never shows
+// in the shell history or the process list. It returns the DSN they make.
+func promptDSN() (string, error) {
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question, fallback string) (string, error) {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, fallback)
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer, nil
+		}
+		return fallback, nil
+	}
+	fmt.Fprintln(os.Stderr, "No DSN given, connecting interactively")
+	host, err := ask("Host", "localhost:9000")
+	if err != nil {
+		return "", err
+	}
+	user, err := ask("User", "default")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	dsn := url.URL{Scheme: "clickhouse", User: url.UserPassword(user, string(password)), Host: host}
+	return dsn.String(), nil
+}
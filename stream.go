@@ -0,0 +1,197 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"clickhouse-monitor/monitor"
+)
+
+// isFIFO reports whether path is an existing named pipe.
+func isFIFO(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// streamRotation is when a -stream file is rotated. Zero values disable
+// rotating by that criterion.
+type streamRotation struct {
+	size     int64
+	interval time.Duration
+}
+
+// checkStream returns an error if openStream would refuse its arguments,
+// without opening path.
+func checkStream(path, format string, rotation streamRotation) error {
+	if format != "jsonl" && format != "csv" {
+		return fmt.Errorf("invalid -stream-format %q: expected jsonl or csv", format)
+	}
+	if isFIFO(path) && (rotation.size > 0 || rotation.interval > 0) {
+		return fmt.Errorf("%s is a named pipe, which cannot be rotated", path)
+	}
+	return nil
+}
+
+// openStream opens path, a file or a named pipe, for -stream in format
+// ("jsonl" or "csv"). Opening a named pipe blocks until a reader opens it.
+// Files are rotated according to rotation, which pipes do not support. A
+// path ending in .gz is gzip-compressed.
+func openStream(path, format string, tags map[string]string, rotation streamRotation) (*streamSink, error) {
+	if err := checkStream(path, format, rotation); err != nil {
+		return nil, err
+	}
+	if isFIFO(path) {
+		log.Printf("Waiting for a reader to open the named pipe %s", path)
+	}
+	s := &streamSink{path: path, format: format, tags: tags, rotation: rotation}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// streamSink writes measurements to a -stream file or pipe. Once a write
+// fails, e.g. because the reader of a pipe went away, it logs once and stops
+// streaming rather than failing every sample.
+type streamSink struct {
+	path     string
+	format   string
+	tags     map[string]string
+	rotation streamRotation
+
+	// mu guards against Close on an exit path racing a Write
+	mu      sync.Mutex
+	f       *os.File
+	gz      *gzip.Writer
+	counter *countingWriter
+	sink    monitor.Sink
+	opened  time.Time
+	rotated int
+	stopped bool
+	closed  bool
+}
+
+// open (re)creates the stream file, with a fresh sink so that a CSV file
+// gets its own header.
+func (s *streamSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.f, s.counter, s.opened = f, &countingWriter{w: f}, time.Now()
+	// The counter sits below gzip, so that rotation goes by the size on
+	// disk, which Write keeps current by flushing gzip after every row
+	var w io.Writer = s.counter
+	if strings.HasSuffix(s.path, ".gz") {
+		s.gz = gzip.NewWriter(s.counter)
+		w = s.gz
+	}
+	if s.format == "csv" {
+		s.sink = monitor.NewCSVSink(w)
+	} else {
+		s.sink = monitor.NewJSONLinesSink(w, s.tags)
+	}
+	return nil
+}
+
+// closeFile flushes and closes the current file. Closing the gzip stream
+// writes its footer, without which the file reads as truncated.
+func (s *streamSink) closeFile() error {
+	if s.gz != nil {
+		if err := s.gz.Close(); err != nil {
+			s.f.Close()
+			return err
+		}
+		s.gz = nil
+	}
+	return s.f.Close()
+}
+
+// due reports whether the current file is complete and must be rotated
+// before the next row. An empty file is never rotated.
+func (s *streamSink) due() bool {
+	if s.counter.n == 0 {
+		return false
+	}
+	return (s.rotation.size > 0 && s.counter.n >= s.rotation.size) ||
+		(s.rotation.interval > 0 && time.Since(s.opened) >= s.rotation.interval)
+}
+
+// rotate renames the current file to a numbered one next to it, e.g.
+// out.csv to out.1.csv or out.csv.gz to out.1.csv.gz, and starts a new file
+// at the original path.
+func (s *streamSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	s.rotated++
+	base, gz := strings.CutSuffix(s.path, ".gz")
+	ext := filepath.Ext(base)
+	if gz {
+		ext += ".gz"
+	}
+	name := fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, filepath.Ext(base)), s.rotated, ext)
+	if err := os.Rename(s.path, name); err != nil {
+		return err
+	}
+	log.Printf("Rotated %s to %s", s.path, name)
+	return s.open()
+}
+
+func (s *streamSink) Write(m monitor.Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil
+	}
+	// Rotating between rows means no row is ever split across files
+	if s.due() {
+		if err := s.rotate(); err != nil {
+			s.stopped = true
+			log.Printf("Error rotating %s, no longer streaming: %v", s.path, err)
+			return nil
+		}
+	}
+	err := s.sink.Write(m)
+	if err == nil && s.gz != nil {
+		// Flush every row, at some cost in compression, so that a reader
+		// tailing the file sees it as soon as it is collected
+		err = s.gz.Flush()
+	}
+	if err != nil {
+		s.stopped = true
+		log.Printf("Error streaming to %s, no longer streaming: %v", s.path, err)
+	}
+	return nil
+}
+
+// Close closes the stream. Later writes are dropped, so that it can be
+// called on an exit path while samples still arrive.
+func (s *streamSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed, s.stopped = true, true
+	return s.closeFile()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w *os.File
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
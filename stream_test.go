@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"clickhouse-monitor/monitor"
+)
+
+// readGzip returns what can be decompressed of the gzip file at path,
+// which need not be complete.
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, zr); err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return out.String()
+}
+
+func TestStreamGzipFlushesEveryRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv.gz")
+	s, err := openStream(path, "csv", nil, streamRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		s.Write(monitor.Measurement{Timestamp: start.Add(time.Duration(i) * time.Second), Connections: i})
+		// Every row is readable before the file is closed
+		rows, err := monitor.ReadCSV(bytes.NewBufferString(readGzip(t, path)))
+		if err != nil {
+			t.Fatalf("after %d rows: %v", i+1, err)
+		}
+		if len(rows) != i+1 {
+			t.Errorf("after %d rows, read %d", i+1, len(rows))
+		}
+	}
+}
+
+func TestStreamRotateSize(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		file  string
+		size  int64
+		files int
+	}{
+		{"every row", "out.csv", 1, 4},
+		// The header and two rows pass 200 bytes
+		{"every two rows", "out.csv", 200, 2},
+		{"gzip", "out.csv.gz", 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			s, err := openStream(path, "csv", nil, streamRotation{size: tt.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 4; i++ {
+				s.Write(monitor.Measurement{Timestamp: start.Add(time.Duration(i) * time.Second), Connections: i})
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Oldest first, ending with the current file
+			var paths []string
+			for i := 1; ; i++ {
+				rotated := filepath.Join(dir, fmt.Sprintf("out.%d.csv", i))
+				if filepath.Ext(tt.file) == ".gz" {
+					rotated += ".gz"
+				}
+				if _, err := os.Stat(rotated); err != nil {
+					break
+				}
+				paths = append(paths, rotated)
+			}
+			paths = append(paths, path)
+			if len(paths) != tt.files {
+				t.Fatalf("got %d files, want %d", len(paths), tt.files)
+			}
+
+			next := 0
+			for _, p := range paths {
+				var content string
+				if filepath.Ext(p) == ".gz" {
+					content = readGzip(t, p)
+				} else {
+					data, err := os.ReadFile(p)
+					if err != nil {
+						t.Fatal(err)
+					}
+					content = string(data)
+				}
+				// ReadCSV requires the header, and fails on a split row
+				if !strings.HasPrefix(content, "timestamp,") {
+					t.Errorf("%s does not start with a header", p)
+				}
+				rows, err := monitor.ReadCSV(strings.NewReader(content))
+				if err != nil {
+					t.Fatalf("%s: %v", p, err)
+				}
+				if len(rows) == 0 {
+					t.Errorf("%s has no rows", p)
+				}
+				for _, m := range rows {
+					if m.Connections != next {
+						t.Errorf("%s has row %d, want %d", p, m.Connections, next)
+					}
+					next++
+				}
+			}
+			if next != 4 {
+				t.Errorf("read %d rows, want 4", next)
+			}
+		})
+	}
+}
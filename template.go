@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"text/template"
+
+	"clickhouse-monitor/monitor"
+)
+
+// templateMeasurement is the data of -format-template: every Measurement
+// field plus durations in milliseconds, so templates need no arithmetic.
+type templateMeasurement struct {
+	monitor.Measurement
+}
+
+// DurationMs is the monitor's query duration in milliseconds.
+func (m templateMeasurement) DurationMs() float64 {
+	return float64(m.QueryDuration.Microseconds()) / 1000
+}
+
+// P50Ms and P99Ms are the query_log percentiles in milliseconds.
+func (m templateMeasurement) P50Ms() float64 {
+	return float64(m.QueryP50.Microseconds()) / 1000
+}
+
+func (m templateMeasurement) P99Ms() float64 {
+	return float64(m.QueryP99.Microseconds()) / 1000
+}
+
+// parseFormatTemplate parses a -format-template and checks it against an
+// empty measurement, so that unknown fields fail at startup rather than on
+// the first sample.
+func parseFormatTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("format").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, templateMeasurement{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ANSI SGR codes of the colors used on the terminal.
+const (
+	ansiRed   = "31"
+	ansiGreen = "32"
+	ansiCyan  = "36"
+)
+
+// isTerminal reports whether f is a terminal rather than a file, a pipe or
+// another character device such as /dev/null.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// colorsEnabled reports whether stdout gets ANSI colors: only on a terminal,
+// and never with NO_COLOR set to anything (https://no-color.org) or
+// -no-color.
+func colorsEnabled(noColor bool) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// painter colors terminal output if enabled.
+type painter bool
+
+// paint returns s in the color with the ANSI SGR code, or as is if colors
+// are disabled.
+func (p painter) paint(code, s string) string {
+	if !p {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
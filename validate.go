@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// validatingConfig is set by -validate-config, so that fatalf collects
+	// configuration errors into configProblems rather than exiting on the
+	// first, and reportConfig reports them all at once.
+	validatingConfig bool
+	configProblems   []string
+)
+
+// checkWritable returns an error if path, a file the run would write, cannot
+// be written, without changing it: an existing file is opened for writing
+// and a new one must be creatable in its directory. Named pipes are not
+// opened, as that would block until a reader arrives.
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	case err == nil && info.Mode()&os.ModeNamedPipe != 0:
+		return nil
+	case err == nil:
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	return checkWritableDir(filepath.Dir(path))
+}
+
+// checkWritableDir returns an error if no file can be created in dir.
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".clickhouse-monitor-validate-*")
+	if pathErr := (*os.PathError)(nil); errors.As(err, &pathErr) {
+		// Name the directory rather than the temporary file
+		return fmt.Errorf("%s: %v", dir, pathErr.Err)
+	} else if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// reportConfig logs every problem found by -validate-config, and exits with
+// exitConfig if there are any.
+func reportConfig() {
+	if len(configProblems) == 0 {
+		log.Println("Configuration OK")
+		os.Exit(exitOK)
+	}
+	for _, problem := range configProblems {
+		errorLog.Print(problem)
+	}
+	if len(configProblems) == 1 {
+		errorLog.Printf("Error: found 1 configuration problem")
+	} else {
+		errorLog.Printf("Error: found %d configuration problems", len(configProblems))
+	}
+	os.Exit(exitConfig)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"clickhouse-monitor/monitor"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// verifyTimeout bounds each step of -verify, so that a hung server fails
+// the check instead of blocking it.
+const verifyTimeout = 10 * time.Second
+
+// runVerify runs the -verify self-test: it pings the server, takes one
+// sample running every configured query, and renders a chart of it to a
+// temp file, writing OK or FAIL for each step to w. It reports whether every
+// step passed.
+func runVerify(w io.Writer, conn driver.Conn, m *monitor.Monitor, chartOpts monitor.ChartOptions) bool {
+	passed := true
+	check := func(name string, err error) {
+		if err != nil {
+			passed = false
+			fmt.Fprintf(w, "FAIL %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(w, "OK   %s\n", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+	if err := conn.Ping(ctx); err != nil {
+		// Every query would fail the same way
+		check("ping", err)
+		return false
+	}
+	check("ping", nil)
+
+	ctx, cancel = context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+	measurement, steps := m.Verify(ctx)
+	for _, step := range steps {
+		check("query "+step.Name, step.Err)
+	}
+
+	check("render chart", verifyChart(measurement, chartOpts))
+	return passed
+}
+
+// verifyChart renders a chart of the measurement to a temp file, which is
+// removed again.
+func verifyChart(measurement monitor.Measurement, chartOpts monitor.ChartOptions) error {
+	f, err := os.CreateTemp("", "clickhouse-monitor-verify-*.png")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	return monitor.WriteChart(f.Name(), []monitor.Measurement{measurement}, chartOpts)
+}
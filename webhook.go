@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"clickhouse-monitor/monitor"
+)
+
+// webhookTimeout bounds each -webhook-url request, so that a slow endpoint
+// cannot hold up the shutdown.
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the JSON posted to -webhook-url for a breach. Text makes
+// it readable as is by Slack and compatible chat webhooks.
+type webhookPayload struct {
+	Text string `json:"text"`
+	monitor.Breach
+	// Suppressed is the number of breaches of the same metric throttled
+	// since the previous notification.
+	Suppressed int               `json:"suppressed,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	// ChartPNG is the chart so far, base64-encoded, with -webhook-chart.
+	ChartPNG string `json:"chart_png_base64,omitempty"`
+}
+
+// webhookNotifier posts breaches to a webhook in the background, at most
+// once per throttle per metric so that a sustained breach does not flood
+// the channel.
+type webhookNotifier struct {
+	url      string
+	throttle time.Duration
+	tags     map[string]string
+	// chart renders the chart so far, if it is attached.
+	chart  func() ([]byte, error)
+	client *http.Client
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+	wg         sync.WaitGroup
+}
+
+func newWebhookNotifier(rawURL string, throttle time.Duration, tags map[string]string, chart func() ([]byte, error)) (*webhookNotifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -webhook-url %q: expected an http or https URL", rawURL)
+	}
+	return &webhookNotifier{
+		url:        rawURL,
+		throttle:   throttle,
+		tags:       tags,
+		chart:      chart,
+		client:     &http.Client{Timeout: webhookTimeout},
+		last:       map[string]time.Time{},
+		suppressed: map[string]int{},
+	}, nil
+}
+
+// Notify posts b unless the same metric was notified within the throttle.
+func (n *webhookNotifier) Notify(b monitor.Breach, text string) {
+	n.mu.Lock()
+	if last, ok := n.last[b.Metric]; ok && time.Since(last) < n.throttle {
+		n.suppressed[b.Metric]++
+		n.mu.Unlock()
+		return
+	}
+	n.last[b.Metric] = time.Now()
+	payload := webhookPayload{Text: text, Breach: b, Suppressed: n.suppressed[b.Metric], Tags: n.tags}
+	n.suppressed[b.Metric] = 0
+	n.mu.Unlock()
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.post(payload); err != nil {
+			log.Printf("Error posting to -webhook-url: %v", err)
+		}
+	}()
+}
+
+func (n *webhookNotifier) post(payload webhookPayload) error {
+	if n.chart != nil {
+		png, err := n.chart()
+		if err != nil {
+			log.Printf("Error rendering the chart for -webhook-url, posting without it: %v", err)
+		} else {
+			payload.ChartPNG = base64.StdEncoding.EncodeToString(png)
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got %s", resp.Status)
+	}
+	return nil
+}
+
+// Wait waits for the notifications in flight.
+func (n *webhookNotifier) Wait() {
+	n.wg.Wait()
+}